@@ -1,5 +1,10 @@
 package avltree
 
+import (
+	"errors"
+	"strconv"
+)
+
 type NodeType string
 
 type rebalancingStrategy string
@@ -17,6 +22,11 @@ const (
 )
 
 // An AVLTree whose keys are fixed to integers
+// Each node carries aggregates about its subtree :
+//   - Size  : number of nodes in the subtree
+//   - Total : sum of every value held by the nodes of the subtree
+// Heights are cached in nodes as well, and maintained through insertions and rotations.
+// Values should only be modified through Update or Increment, so that aggregates stay accurate.
 type AVLTree struct {
 	Key      int
 	Values   map[int]int
@@ -24,19 +34,61 @@ type AVLTree struct {
 	Right    *AVLTree
 	Parent   *AVLTree
 	NodeType NodeType
+	Size     int
+	Total    int
+	weight   int
+	height   int
 }
 
 // New returns leafless tree, with height set to 0
 func New(key int, values map[int]int) *AVLTree {
-	return &AVLTree{key, values, nil, nil, nil, Root}
+	return newTree(key, values, nil, Root)
+}
+
+// FromSorted : builds a perfectly balanced tree in O(n), from strictly increasing keys and their associated values
+func FromSorted(keys []int, values []map[int]int) (*AVLTree, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("Cannot build a tree from no keys")
+	}
+
+	if len(keys) != len(values) {
+		return nil, errors.New("Cannot build a tree from " + strconv.Itoa(len(keys)) + " keys and " + strconv.Itoa(len(values)) + " values")
+	}
+
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			return nil, errors.New("Cannot build a tree : keys are not strictly increasing at index " + strconv.Itoa(i))
+		}
+	}
+
+	return fromSorted(keys, values, nil, Root), nil
+}
+
+func fromSorted(keys []int, values []map[int]int, parent *AVLTree, nodeType NodeType) *AVLTree {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	middle := len(keys) / 2
+	tree := newTree(keys[middle], values[middle], parent, nodeType)
+	tree.Left = fromSorted(keys[:middle], values[:middle], tree, LeftChild)
+	tree.Right = fromSorted(keys[middle+1:], values[middle+1:], tree, RightChild)
+	tree.refresh()
+
+	return tree
 }
 
 func newLeftTree(key int, values map[int]int, parent *AVLTree) *AVLTree {
-	return &AVLTree{key, values, nil, nil, parent, LeftChild}
+	return newTree(key, values, parent, LeftChild)
 }
 
 func newRightTree(key int, values map[int]int, parent *AVLTree) *AVLTree {
-	return &AVLTree{key, values, nil, nil, parent, RightChild}
+	return newTree(key, values, parent, RightChild)
+}
+
+func newTree(key int, values map[int]int, parent *AVLTree, nodeType NodeType) *AVLTree {
+	weight := sum(values)
+	return &AVLTree{key, values, nil, nil, parent, nodeType, 1, weight, weight, 0}
 }
 
 // Get : lookup a key in the tree
@@ -70,6 +122,7 @@ func (tree *AVLTree) Between(lower, higher int) *AVLTree {
 
 		newTree.Left = newLeft
 		newTree.Right = newRight
+		newTree.refresh()
 	}
 
 	if tree.Key < lower {
@@ -83,19 +136,119 @@ func (tree *AVLTree) Between(lower, higher int) *AVLTree {
 	return &newTree
 }
 
+// Iterator : called for each visited node, in key order. Returning false stops the walk.
+type Iterator func(key int, values map[int]int) bool
+
+// Ascend : walks the whole tree in ascending key order, without copying any node
+func (tree *AVLTree) Ascend(iterator Iterator) {
+	tree.ascendRange(nil, nil, iterator)
+}
+
+// Descend : walks the whole tree in descending key order, without copying any node
+func (tree *AVLTree) Descend(iterator Iterator) {
+	tree.descendRange(nil, nil, iterator)
+}
+
+// AscendRange : walks the nodes with lower <= tree.Key <= higher in ascending key order
+func (tree *AVLTree) AscendRange(lower, higher int, iterator Iterator) {
+	tree.ascendRange(&lower, &higher, iterator)
+}
+
+// DescendRange : walks the nodes with lower <= tree.Key <= higher in descending key order, starting from higher.
+// Bounds are given in the same order as AscendRange.
+func (tree *AVLTree) DescendRange(lower, higher int, iterator Iterator) {
+	tree.descendRange(&lower, &higher, iterator)
+}
+
+// A nil bound means the range is open on that side.
+// The returned boolean is false as soon as the iterator asked to stop.
+func (tree *AVLTree) ascendRange(lower, higher *int, iterator Iterator) bool {
+	if tree == nil {
+		return true
+	}
+
+	if lower != nil && tree.Key < *lower {
+		return tree.Right.ascendRange(lower, higher, iterator)
+	}
+
+	if higher != nil && tree.Key > *higher {
+		return tree.Left.ascendRange(lower, higher, iterator)
+	}
+
+	if !tree.Left.ascendRange(lower, higher, iterator) {
+		return false
+	}
+
+	if !iterator(tree.Key, tree.Values) {
+		return false
+	}
+
+	return tree.Right.ascendRange(lower, higher, iterator)
+}
+
+func (tree *AVLTree) descendRange(lower, higher *int, iterator Iterator) bool {
+	if tree == nil {
+		return true
+	}
+
+	if lower != nil && tree.Key < *lower {
+		return tree.Right.descendRange(lower, higher, iterator)
+	}
+
+	if higher != nil && tree.Key > *higher {
+		return tree.Left.descendRange(lower, higher, iterator)
+	}
+
+	if !tree.Right.descendRange(lower, higher, iterator) {
+		return false
+	}
+
+	if !iterator(tree.Key, tree.Values) {
+		return false
+	}
+
+	return tree.Left.descendRange(lower, higher, iterator)
+}
+
 // Update : when the key is present, replaces it's associated value
 func (tree *AVLTree) Update(key int, values map[int]int) {
 	if tree != nil {
 		if key == tree.Key {
 			tree.Values = values
+			tree.weight = sum(values)
 		} else if key < tree.Key {
 			tree.Left.Update(key, values)
 		} else if key > tree.Key {
 			tree.Right.Update(key, values)
 		}
+		tree.refresh()
 	}
 }
 
+// Increment : when the key is present, increments the value associated to id by one.
+// Unlike Update, aggregates are maintained without going through the whole values.
+func (tree *AVLTree) Increment(key int, id int) bool {
+	if tree == nil {
+		return false
+	}
+
+	found := false
+	if key == tree.Key {
+		tree.Values[id]++
+		tree.weight++
+		found = true
+	} else if key < tree.Key {
+		found = tree.Left.Increment(key, id)
+	} else if key > tree.Key {
+		found = tree.Right.Increment(key, id)
+	}
+
+	if found {
+		tree.Total++
+	}
+	return found
+}
+
 // Insert : self balancing insertion
 func (tree *AVLTree) Insert(key int, values map[int]int) {
 	if key < tree.Key {
@@ -112,18 +265,93 @@ func (tree *AVLTree) Insert(key int, values map[int]int) {
 		}
 	}
 
+	tree.refresh()
 	tree.balance()
 }
 
+// Count : number of nodes in the tree
 func (tree *AVLTree) Count() int {
 	if tree == nil {
 		return 0
 	}
 
-	return 1 + tree.Left.Count() + tree.Right.Count()
+	return tree.Size
+}
+
+// Sum : sum of every value held by the tree
+func (tree *AVLTree) Sum() int {
+	if tree == nil {
+		return 0
+	}
+
+	return tree.Total
+}
+
+// Rank : number of keys in the tree strictly lower than key
+func (tree *AVLTree) Rank(key int) int {
+	if tree == nil {
+		return 0
+	}
+
+	if key <= tree.Key {
+		return tree.Left.Rank(key)
+	}
+
+	return 1 + tree.Left.Count() + tree.Right.Rank(key)
+}
+
+// Select : returns the node holding the i-th lowest key (starting from 0), or nil when out of bounds
+func (tree *AVLTree) Select(i int) *AVLTree {
+	if tree == nil || i < 0 || i >= tree.Size {
+		return nil
+	}
+
+	leftCount := tree.Left.Count()
+	if i < leftCount {
+		return tree.Left.Select(i)
+	} else if i > leftCount {
+		return tree.Right.Select(i - leftCount - 1)
+	}
+
+	return tree
+}
+
+// SumBetween : sum of every value held by the nodes with lower <= tree.Key <= higher
+func (tree *AVLTree) SumBetween(lower, higher int) int {
+	if lower > higher {
+		return 0
+	}
+
+	return tree.sumUpTo(higher) - tree.sumBelow(lower)
+}
+
+// sum of the values held by the nodes with tree.Key < key
+func (tree *AVLTree) sumBelow(key int) int {
+	if tree == nil {
+		return 0
+	}
+
+	if key <= tree.Key {
+		return tree.Left.sumBelow(key)
+	}
+
+	return tree.Left.Sum() + tree.weight + tree.Right.sumBelow(key)
+}
+
+// sum of the values held by the nodes with tree.Key <= key
+func (tree *AVLTree) sumUpTo(key int) int {
+	if tree == nil {
+		return 0
+	}
+
+	if key < tree.Key {
+		return tree.Left.sumUpTo(key)
+	}
+
+	return tree.Left.Sum() + tree.weight + tree.Right.sumUpTo(key)
 }
 
-// Height : computes the height of a tree
+// Height : height of a tree, read from the node in O(1)
 // A leaf has height == 0
 // A Tree with one leaf | right | both children has height == 1
 func (tree *AVLTree) Height() int {
@@ -131,7 +359,7 @@ func (tree *AVLTree) Height() int {
 		return -1
 	}
 
-	return 1 + max(tree.Left.Height(), tree.Right.Height())
+	return tree.height
 }
 
 // Balance = Height(right subtree) - Height(left subtree)
@@ -169,6 +397,8 @@ func (tree *AVLTree) LeftRotate() {
 		*tree = newRoot
 		groomLeft(tree)
 		groomRight(tree)
+		tree.Left.refresh()
+		tree.refresh()
 	}
 }
 
@@ -194,6 +424,8 @@ func (tree *AVLTree) RightRotate() {
 		*tree = newRoot
 		groomLeft(tree)
 		groomRight(tree)
+		tree.Right.refresh()
+		tree.refresh()
 	}
 }
 
@@ -261,6 +493,64 @@ func getRebalanceStrategy(tree *AVLTree) rebalancingStrategy {
 	return noRebalancing
 }
 
+// Validate : checks that the tree respects every invariant it relies on, and returns the first violation found :
+//   - BST ordering : keys in a left subtree are lower than the node key, keys in a right subtree are higher
+//   - AVL balance : the balance of each node is -1, 0 or 1
+//   - children reference their parent, and are labelled with the side they hang from
+//   - cached heights and aggregates match the subtree they describe
+func (tree *AVLTree) Validate() error {
+	return tree.validate(nil, nil)
+}
+
+func (tree *AVLTree) validate(lower, higher *int) error {
+	if tree == nil {
+		return nil
+	}
+
+	key := strconv.Itoa(tree.Key)
+	if (lower != nil && tree.Key <= *lower) || (higher != nil && tree.Key >= *higher) {
+		return errors.New("Key " + key + " breaks the ordering of the tree")
+	}
+
+	balance := tree.Balance()
+	if balance < -1 || balance > 1 {
+		return errors.New("Node " + key + " is unbalanced : " + strconv.Itoa(balance))
+	}
+
+	if tree.Left != nil && (tree.Left.Parent != tree || tree.Left.NodeType != LeftChild) {
+		return errors.New("Left child of node " + key + " is not linked to its parent")
+	}
+
+	if tree.Right != nil && (tree.Right.Parent != tree || tree.Right.NodeType != RightChild) {
+		return errors.New("Right child of node " + key + " is not linked to its parent")
+	}
+
+	if tree.height != 1+max(tree.Left.Height(), tree.Right.Height()) {
+		return errors.New("Node " + key + " has a wrong cached height : " + strconv.Itoa(tree.height))
+	}
+
+	if tree.Size != 1+tree.Left.Count()+tree.Right.Count() {
+		return errors.New("Node " + key + " has a wrong subtree size : " + strconv.Itoa(tree.Size))
+	}
+
+	if tree.weight != sum(tree.Values) || tree.Total != tree.weight+tree.Left.Sum()+tree.Right.Sum() {
+		return errors.New("Node " + key + " has a wrong subtree total : " + strconv.Itoa(tree.Total))
+	}
+
+	if err := tree.Left.validate(lower, &tree.Key); err != nil {
+		return err
+	}
+
+	return tree.Right.validate(&tree.Key, higher)
+}
+
+// refresh recomputes the height and aggregates of a node from its children's
+func (tree *AVLTree) refresh() {
+	tree.height = 1 + max(tree.Left.Height(), tree.Right.Height())
+	tree.Size = 1 + tree.Left.Count() + tree.Right.Count()
+	tree.Total = tree.weight + tree.Left.Sum() + tree.Right.Sum()
+}
+
 func groomLeft(tree *AVLTree) {
 	if tree.Left != nil {
 		tree.Left.Parent = tree
@@ -269,11 +559,13 @@ func groomLeft(tree *AVLTree) {
 		leftLeft := tree.Left.Left
 		if leftLeft != nil {
 			leftLeft.Parent = tree.Left
+			leftLeft.NodeType = LeftChild
 		}
 
 		leftRight := tree.Left.Right
 		if leftRight != nil {
 			leftRight.Parent = tree.Left
+			leftRight.NodeType = RightChild
 		}
 	}
 }
@@ -286,15 +578,25 @@ func groomRight(tree *AVLTree) {
 		rightLeft := tree.Right.Left
 		if rightLeft != nil {
 			rightLeft.Parent = tree.Right
+			rightLeft.NodeType = LeftChild
 		}
 
 		rightRight := tree.Right.Right
 		if rightRight != nil {
 			rightRight.Parent = tree.Right
+			rightRight.NodeType = RightChild
 		}
 	}
 }
 
+func sum(values map[int]int) int {
+	total := 0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
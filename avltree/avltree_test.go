@@ -19,6 +19,41 @@ func Test_New_ShouldHave_NoBranches_NoParent_HeightOfZero_BalanceOfZero_NodeType
 	assert.Equal(t, Root, tree.NodeType, "Root should be Root node type")
 }
 
+func Test_FromSorted_ShouldBuildBalancedTree(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 10, 1000, 1023, 1024} {
+		keys := make([]int, n)
+		values := make([]map[int]int, n)
+		for i := range keys {
+			keys[i] = i * 2
+			values[i] = mapOf(i)
+		}
+
+		tree, err := FromSorted(keys, values)
+		assert.NoError(t, err, "Sorted keys should build a tree")
+		assert.NoError(t, tree.Validate(), "A tree built from sorted keys should be valid")
+		assert.Equal(t, n, tree.Count(), "Every key should be in the tree")
+		assert.Equal(t, mapOf(n-1), tree.Get((n-1)*2), "Values should be associated to their key")
+
+		tree.Insert(-1, mapOf(-1))
+		tree.Insert(n*2, mapOf(n))
+		assert.NoError(t, tree.Validate(), "A tree built from sorted keys should stay valid through inserts")
+	}
+}
+
+func Test_FromSorted_ShouldFail(t *testing.T) {
+	_, err := FromSorted([]int{}, []map[int]int{})
+	assert.Error(t, err, "A tree cannot be built without keys")
+
+	_, err = FromSorted([]int{1, 2}, []map[int]int{mapOf(1)})
+	assert.Error(t, err, "Each key should have its values")
+
+	_, err = FromSorted([]int{1, 3, 2}, []map[int]int{mapOf(1), mapOf(3), mapOf(2)})
+	assert.Error(t, err, "Keys should be sorted")
+
+	_, err = FromSorted([]int{1, 1}, []map[int]int{mapOf(1), mapOf(1)})
+	assert.Error(t, err, "Keys should be unique")
+}
+
 func Test_Get_ElementExists(t *testing.T) {
 	tree := New(0, mapOf(0))
 	tree.Insert(1, mapOf(1))
@@ -52,6 +87,84 @@ func Test_GetBetween_ShouldExclude_OutOfBoundsValues(t *testing.T) {
 	assert.Equal(t, mapOf(2), actual.Get(2), "Resulting tree should contain key 2")
 }
 
+func Test_Ascend_ShouldVisitKeysInOrder(t *testing.T) {
+	tree := getTree(100, false)
+
+	visited := make([]int, 0, tree.Count())
+	tree.Ascend(func(key int, values map[int]int) bool {
+		visited = append(visited, key)
+		return true
+	})
+
+	assert.Equal(t, tree.Count(), len(visited), "Every node should have been visited")
+	for i := 1; i < len(visited); i++ {
+		assert.True(t, visited[i-1] < visited[i], "Keys should be visited in ascending order")
+	}
+}
+
+func Test_Descend_ShouldVisitKeysInReverseOrder(t *testing.T) {
+	tree := getTree(100, false)
+
+	visited := make([]int, 0, tree.Count())
+	tree.Descend(func(key int, values map[int]int) bool {
+		visited = append(visited, key)
+		return true
+	})
+
+	assert.Equal(t, tree.Count(), len(visited), "Every node should have been visited")
+	for i := 1; i < len(visited); i++ {
+		assert.True(t, visited[i-1] > visited[i], "Keys should be visited in descending order")
+	}
+}
+
+func Test_AscendRange_ShouldOnlyVisitKeysInBounds(t *testing.T) {
+	tree := getTree(100, false)
+
+	visited := []int{}
+	tree.AscendRange(10, 20, func(key int, values map[int]int) bool {
+		visited = append(visited, key)
+		return true
+	})
+
+	assert.Equal(t, []int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, visited, "Only keys between 10 and 20 should have been visited")
+}
+
+func Test_DescendRange_ShouldOnlyVisitKeysInBounds(t *testing.T) {
+	tree := getTree(100, false)
+
+	visited := []int{}
+	tree.DescendRange(10, 20, func(key int, values map[int]int) bool {
+		visited = append(visited, key)
+		return true
+	})
+
+	assert.Equal(t, []int{20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10}, visited, "Only keys between 10 and 20 should have been visited, the highest first")
+}
+
+func Test_AscendRange_ShouldStopWhenIteratorReturnsFalse(t *testing.T) {
+	tree := getTree(100, false)
+
+	visited := []int{}
+	tree.AscendRange(0, 99, func(key int, values map[int]int) bool {
+		visited = append(visited, key)
+		return len(visited) < 3
+	})
+
+	assert.Equal(t, []int{0, 1, 2}, visited, "The walk should have stopped after three keys")
+}
+
+func Test_AscendRange_ShouldNotCopyNodes(t *testing.T) {
+	tree := New(0, mapOf(0))
+	tree.Insert(1, mapOf(1))
+
+	tree.AscendRange(1, 1, func(key int, values map[int]int) bool {
+		values[42] = 42
+		return true
+	})
+
+	assert.Equal(t, 42, tree.Get(1)[42], "The iterator should have been given the live values")
+}
+
 func Test_Update_KeyExists(t *testing.T) {
 	tree := New(0, mapOf(0))
 	tree.Insert(1, mapOf(1))
@@ -66,6 +179,60 @@ func Test_Update_KeyExists(t *testing.T) {
 	assert.Equal(t, mapOf(30), tree.Get(2), "Should have found \"30\"")
 }
 
+func Test_Increment_KeyExists(t *testing.T) {
+	tree := New(0, mapOf(0))
+	tree.Insert(1, mapOf(1))
+
+	assert.True(t, tree.Increment(1, 1), "Key 1 should have been found")
+	assert.True(t, tree.Increment(1, 2), "Key 1 should have been found")
+	assert.Equal(t, map[int]int{1: 1, 2: 1}, tree.Get(1), "Values of key 1 should have been incremented")
+	assert.Equal(t, 2, tree.Sum(), "Tree total should have been incremented")
+}
+
+func Test_Increment_KeyAbsent(t *testing.T) {
+	tree := New(0, mapOf(0))
+	assert.False(t, tree.Increment(1, 1), "Key 1 should not have been found")
+	assert.Equal(t, 0, tree.Sum(), "Tree total should not have changed")
+}
+
+func Test_Aggregates_ShouldBeMaintainedThroughRotations(t *testing.T) {
+	tree := New(-1, map[int]int{0: 1})
+	for _, key := range rand.Perm(1000) {
+		tree.Insert(key, map[int]int{0: 1})
+	}
+
+	assert.True(t, aggregatesSanityCheck(tree), "At least one node has wrong height, size or total")
+	assert.Equal(t, 1001, tree.Count(), "Tree should hold 1001 nodes")
+	assert.Equal(t, 1001, tree.Sum(), "Tree total should be 1001")
+}
+
+func Test_Rank(t *testing.T) {
+	tree := getTree(100, false)
+	assert.Equal(t, 0, tree.Rank(-1), "No key should be lower than -1")
+	assert.Equal(t, 11, tree.Rank(10), "Keys -1 to 9 should be lower than 10")
+	assert.Equal(t, 101, tree.Rank(1000), "Every key should be lower than 1000")
+}
+
+func Test_Select(t *testing.T) {
+	tree := getTree(100, false)
+	assert.Equal(t, -1, tree.Select(0).Key, "Lowest key should be -1")
+	assert.Equal(t, 10, tree.Select(11).Key, "Twelfth lowest key should be 10")
+	assert.Equal(t, 99, tree.Select(100).Key, "Highest key should be 99")
+	assert.Nil(t, tree.Select(101), "Nil should be returned when out of bounds")
+	assert.Nil(t, tree.Select(-1), "Nil should be returned when out of bounds")
+}
+
+func Test_SumBetween(t *testing.T) {
+	tree := New(-1, map[int]int{})
+	for _, key := range rand.Perm(100) {
+		tree.Insert(key, map[int]int{0: key, 1: 1})
+	}
+
+	assert.Equal(t, 10+11+12+3, tree.SumBetween(10, 12), "Sum between 10 and 12 should be 36")
+	assert.Equal(t, 99*100/2+100, tree.SumBetween(-10, 1000), "Sum over the whole tree should be 5050")
+	assert.Equal(t, 0, tree.SumBetween(12, 10), "Sum over an empty range should be 0")
+}
+
 func Test_RightInserts_ShouldIncrementHeight(t *testing.T) {
 	tree := New(50, mapOf(0))
 	tree.Insert(60, mapOf(1))
@@ -155,7 +322,100 @@ func Test_ParentChild_SanityCheck(t *testing.T) {
 
 func Test_NodeType_SanityCheck(t *testing.T) {
 	tree := getTree(1000, false)
-	assert.True(t, parentChildSanityCheck(tree), "At least one left or right node is mislabelled")
+	assert.True(t, nodeTypeSanityChekc(tree), "At least one left or right node is mislabelled")
+}
+
+func Test_Validate_ShouldAcceptValidTree(t *testing.T) {
+	tree := getTree(1000, false)
+	assert.NoError(t, tree.Validate(), "A tree built through Insert should be valid")
+	assert.NoError(t, (*AVLTree)(nil).Validate(), "An empty tree should be valid")
+}
+
+func Test_Validate_ShouldDetectBrokenOrdering(t *testing.T) {
+	tree := getTree(10, false)
+	tree.Select(0).Key = 1000
+	assert.Error(t, tree.Validate(), "A tree with misplaced keys should not be valid")
+}
+
+func Test_Validate_ShouldDetectBrokenParentLink(t *testing.T) {
+	tree := getTree(10, false)
+	tree.Left.Parent = nil
+	assert.Error(t, tree.Validate(), "A tree whose children do not reference their parent should not be valid")
+}
+
+func Test_Validate_ShouldDetectMislabelledNode(t *testing.T) {
+	tree := getTree(10, false)
+	tree.Right.NodeType = LeftChild
+	assert.Error(t, tree.Validate(), "A tree with mislabelled nodes should not be valid")
+}
+
+func Test_Validate_ShouldDetectUnbalancedTree(t *testing.T) {
+	tree := New(0, mapOf(0))
+	tree.Right = newRightTree(1, mapOf(1), tree)
+	tree.Right.Right = newRightTree(2, mapOf(2), tree.Right)
+	tree.Right.refresh()
+	tree.refresh()
+	assert.Error(t, tree.Validate(), "A tree with a balance of 2 should not be valid")
+}
+
+func Test_Validate_ShouldDetectStaleAggregates(t *testing.T) {
+	tree := getTree(10, false)
+	tree.Get(5)[42] = 1
+	assert.Error(t, tree.Validate(), "A tree whose values were modified behind its back should not be valid")
+}
+
+// Each 3 bytes of input make an operation : the first byte picks insert, update, increment or between,
+// and the two others are used as keys (and bounds for between).
+func Fuzz_Operations_ShouldKeepTreeValid(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 0, 2, 0, 0, 3, 0})
+	f.Add([]byte{0, 30, 0, 0, 20, 0, 0, 10, 0, 1, 20, 0, 2, 10, 5, 3, 10, 30})
+	f.Add([]byte{0, 10, 0, 0, 30, 0, 0, 20, 0, 0, 5, 0, 0, 25, 0, 0, 40, 0, 3, 0, 255})
+
+	f.Fuzz(func(t *testing.T, operations []byte) {
+		tree := New(-1, map[int]int{})
+		expected := map[int]int{-1: 0}
+
+		for i := 0; i+2 < len(operations); i += 3 {
+			key, other := int(operations[i+1]), int(operations[i+2])
+
+			switch operations[i] % 4 {
+			case 0:
+				if _, found := expected[key]; !found {
+					expected[key] = 1
+				}
+				tree.Insert(key, map[int]int{0: 1})
+			case 1:
+				if _, found := expected[key]; found {
+					expected[key] = other
+				}
+				tree.Update(key, map[int]int{0: other})
+			case 2:
+				if _, found := expected[key]; found {
+					expected[key]++
+				}
+				tree.Increment(key, other)
+			case 3:
+				between := tree.Between(key, other)
+				between.Ascend(func(k int, values map[int]int) bool {
+					if k < key || k > other {
+						t.Fatalf("Key %d is out of [%d, %d]", k, key, other)
+					}
+					return true
+				})
+			}
+
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("Tree is no longer valid after operation %d : %s", i/3, err.Error())
+			}
+		}
+
+		total := 0
+		for _, value := range expected {
+			total += value
+		}
+		assert.Equal(t, len(expected), tree.Count(), "Tree should hold every inserted key")
+		assert.Equal(t, total, tree.Sum(), "Tree total should match every inserted value")
+	})
 }
 
 func getTree(n int, trace bool) *AVLTree {
@@ -191,6 +451,18 @@ func parentChildSanityCheck(tree *AVLTree) bool {
 	return (leftChildReferencesParent && rightChildReferencesParent) && parentChildSanityCheck(tree.Left) && parentChildSanityCheck(tree.Right)
 }
 
+func aggregatesSanityCheck(tree *AVLTree) bool {
+	if tree == nil {
+		return true
+	}
+
+	expectedHeight := 1 + max(tree.Left.Height(), tree.Right.Height())
+	expectedSize := 1 + tree.Left.Count() + tree.Right.Count()
+	expectedTotal := sum(tree.Values) + tree.Left.Sum() + tree.Right.Sum()
+
+	return tree.height == expectedHeight && tree.Size == expectedSize && tree.Total == expectedTotal && aggregatesSanityCheck(tree.Left) && aggregatesSanityCheck(tree.Right)
+}
+
 func nodeTypeSanityChekc(tree *AVLTree) bool {
 	if tree == nil {
 		return true
@@ -223,3 +495,32 @@ func leftRightAssertions(t *testing.T, expected *AVLTree, actual *AVLTree) {
 func mapOf(key int) map[int]int {
 	return map[int]int{key: 0}
 }
+
+func Benchmark_Insert_SequentialKeys(b *testing.B) {
+	tree := New(-1, mapOf(0))
+	for i := 0; i < b.N; i++ {
+		tree.Insert(i, mapOf(0))
+	}
+}
+
+func Benchmark_Insert_RandomKeys(b *testing.B) {
+	keys := rand.Perm(b.N)
+	b.ResetTimer()
+
+	tree := New(-1, mapOf(0))
+	for _, key := range keys {
+		tree.Insert(key, mapOf(0))
+	}
+}
+
+func Benchmark_Insert_MillionKeys(b *testing.B) {
+	keys := rand.Perm(1000000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree := New(-1, mapOf(0))
+		for _, key := range keys {
+			tree.Insert(key, mapOf(0))
+		}
+	}
+}
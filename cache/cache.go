@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU : a cache holding a fixed number of values, evicting the least recently used one when full.
+// It is safe for concurrent use. Keys should be comparable (e.g. a struct of strings and numbers).
+type LRU struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[interface{}]*list.Element
+	recency  *list.List
+}
+
+// entry : a key and its value, as held by the recency list, the most recently used first
+type entry struct {
+	key   interface{}
+	value interface{}
+}
+
+// New : creates an empty cache holding capacity values at most. A cache with no capacity holds nothing.
+func New(capacity int) *LRU {
+	return &LRU{capacity: capacity, entries: make(map[interface{}]*list.Element), recency: list.New()}
+}
+
+// Get : the value cached under key, if any, which becomes the most recently used
+func (cache *LRU) Get(key interface{}) (interface{}, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, found := cache.entries[key]
+	if !found {
+		return nil, false
+	}
+
+	cache.recency.MoveToFront(element)
+	return element.Value.(*entry).value, true
+}
+
+// Add : caches value under key, evicting the least recently used value when the cache is full
+func (cache *LRU) Add(key, value interface{}) {
+	if cache.capacity < 1 {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, found := cache.entries[key]; found {
+		element.Value.(*entry).value = value
+		cache.recency.MoveToFront(element)
+		return
+	}
+
+	cache.entries[key] = cache.recency.PushFront(&entry{key, value})
+	if cache.recency.Len() > cache.capacity {
+		oldest := cache.recency.Back()
+		cache.recency.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Len : the number of values cached
+func (cache *LRU) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.recency.Len()
+}
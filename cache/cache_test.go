@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LRU_ShouldGetWhatWasAdded(t *testing.T) {
+	cache := New(2)
+	cache.Add("foo", 1)
+
+	value, found := cache.Get("foo")
+	assert.True(t, found, "A value added should be found")
+	assert.Equal(t, 1, value, "The value added should be found")
+
+	_, found = cache.Get("bar")
+	assert.False(t, found, "A value never added should not be found")
+
+	cache.Add("foo", 2)
+	value, _ = cache.Get("foo")
+	assert.Equal(t, 2, value, "Adding under the same key should replace the value")
+	assert.Equal(t, 1, cache.Len(), "Adding under the same key should not add a value")
+}
+
+func Test_LRU_Full_ShouldEvictLeastRecentlyUsed(t *testing.T) {
+	cache := New(2)
+	cache.Add("foo", 1)
+	cache.Add("bar", 2)
+	cache.Get("foo")
+	cache.Add("baz", 3)
+
+	_, found := cache.Get("bar")
+	assert.False(t, found, "The least recently used value should be evicted")
+	_, found = cache.Get("foo")
+	assert.True(t, found, "A value used recently should be kept")
+	_, found = cache.Get("baz")
+	assert.True(t, found, "The value added last should be kept")
+	assert.Equal(t, 2, cache.Len(), "The cache should not hold more than its capacity")
+}
+
+func Test_LRU_NoCapacity_ShouldHoldNothing(t *testing.T) {
+	cache := New(0)
+	cache.Add("foo", 1)
+
+	_, found := cache.Get("foo")
+	assert.False(t, found, "A cache with no capacity should hold nothing")
+}
+
+func Test_LRU_StructKeys_ShouldBeComparedByValue(t *testing.T) {
+	type key struct {
+		prefix  string
+		version uint64
+	}
+	cache := New(2)
+	cache.Add(key{"2015", 1}, 1)
+
+	_, found := cache.Get(key{"2015", 1})
+	assert.True(t, found, "Equal keys should find the same value")
+	_, found = cache.Get(key{"2015", 2})
+	assert.False(t, found, "Keys of another version should not find the value")
+}
@@ -0,0 +1,380 @@
+package config
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomaspepio/hn-queries/logging"
+	"github.com/thomaspepio/hn-queries/parser"
+)
+
+// Config : the application configuration, read from a JSON file
+// Sending SIGHUP to the process reloads the sources, the admin token, the API keys, the sizes, the ingestion limit and CORS, other settings require a restart.
+type Config struct {
+	Sources []Source `json:"sources"`
+
+	// AdminToken : bearer token opening the admin and ingest endpoints. The admin endpoints are disabled when it is empty and no admin API key
+	// is configured, and so is the ingest endpoint when no ingest or admin API key is configured either.
+	AdminToken string `json:"adminToken"`
+
+	// APIKeys : keys the query, ingest and admin endpoints and the gRPC service expect. The query endpoints and the gRPC service are open
+	// to anyone when there is none.
+	APIKeys []APIKey `json:"apiKeys"`
+
+	// Address : address the server listens on
+	Address string `json:"address"`
+
+	// GRPCAddress : address the gRPC service listens on, which is not served when it is empty
+	GRPCAddress string `json:"grpcAddress"`
+
+	// DrainTimeout : how long in-flight requests are waited for on shutdown
+	DrainTimeout Duration `json:"drainTimeout"`
+
+	// ReadTimeout : how long reading a request may take, body included. There is no limit when it is 0.
+	ReadTimeout Duration `json:"readTimeout"`
+
+	// RequestTimeout : how long serving a request may take before it is answered with a 503. There is no limit when it is 0.
+	// Live streams, ingestion and re-indexing are not limited.
+	RequestTimeout Duration `json:"requestTimeout"`
+
+	// CORS : the other origins whose pages browsers let call the API
+	CORS CORS `json:"cors"`
+
+	// Gzip : whether answers are compressed for clients accepting gzip
+	Gzip bool `json:"gzip"`
+
+	// AccessLog : whether every request is logged
+	AccessLog bool `json:"accessLog"`
+
+	// Log : how much is logged, and where
+	Log Log `json:"log"`
+
+	// SnapshotPath : where the index is written on shutdown. No snapshot is written when it is empty.
+	SnapshotPath string `json:"snapshotPath"`
+
+	// LoadSnapshot : whether the index is read on startup from the snapshot, when there is one, instead of the sources.
+	// Off by default : sources edited or added since the snapshot was written are ignored until it is deleted, the index being stale.
+	LoadSnapshot bool `json:"loadSnapshot"`
+
+	// DefaultSize : number of queries the popular endpoint returns when no size is asked for
+	DefaultSize int `json:"defaultSize"`
+
+	// MaxSize : number of queries the popular endpoint returns at most, larger sizes being clamped to it
+	MaxSize int `json:"maxSize"`
+
+	// CacheSize : number of popular answers kept in memory, for as long as the index does not change. Nothing is cached when it is 0.
+	CacheSize int `json:"cacheSize"`
+
+	// MaxIngestBytes : number of bytes the body of an ingestion request can hold, longer bodies being rejected. There is no limit when it is 0.
+	MaxIngestBytes int64 `json:"maxIngestBytes"`
+}
+
+const (
+	// DefaultSize : default value of Config.DefaultSize
+	DefaultSize = 10
+
+	// MaxSize : default value of Config.MaxSize
+	MaxSize = 1000
+
+	// CacheSize : default value of Config.CacheSize
+	CacheSize = 1000
+
+	// MaxIngestBytes : default value of Config.MaxIngestBytes, 32 MiB
+	MaxIngestBytes = 32 << 20
+
+	// DefaultFormat : format of the sources not giving one
+	DefaultFormat = "tsv"
+)
+
+// Log : the logs of the process, written as JSON lines
+type Log struct {
+	Level  string `json:"level"`  // debug | info | warn | error, info by default
+	Output string `json:"output"` // stdout | stderr | the path of a file, stdout by default
+}
+
+// CORS : Cross-Origin Resource Sharing settings. No other origin is allowed when AllowedOrigins is empty.
+type CORS struct {
+	AllowedOrigins []string `json:"allowedOrigins"` // e.g. https://dashboard.example.com, * allowing any origin
+	AllowedMethods []string `json:"allowedMethods"` // GET and POST when empty
+	AllowedHeaders []string `json:"allowedHeaders"` // Accept, Authorization, Content-Type, If-None-Match, X-API-Key and X-Request-ID when empty
+	MaxAge         Duration `json:"maxAge"`         // how long browsers may cache preflight answers
+}
+
+// DefaultAllowedMethods : methods allowed to other origins when CORS.AllowedMethods is empty
+var DefaultAllowedMethods = []string{"GET", "POST"}
+
+// DefaultAllowedHeaders : request headers allowed to other origins when CORS.AllowedHeaders is empty
+var DefaultAllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "If-None-Match", "X-API-Key", "X-Request-ID"}
+
+// Allows : whether pages of origin may call the API
+func (cors CORS) Allows(origin string) bool {
+	for _, allowed := range cors.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Methods : the methods allowed to other origins, falling back to DefaultAllowedMethods
+func (cors CORS) Methods() []string {
+	if len(cors.AllowedMethods) == 0 {
+		return DefaultAllowedMethods
+	}
+
+	return cors.AllowedMethods
+}
+
+// Headers : the request headers allowed to other origins, falling back to DefaultAllowedHeaders
+func (cors CORS) Headers() []string {
+	if len(cors.AllowedHeaders) == 0 {
+		return DefaultAllowedHeaders
+	}
+
+	return cors.AllowedHeaders
+}
+
+// Roles an API key can be granted
+const (
+	// RoleQuery : the query endpoints
+	RoleQuery = "query"
+
+	// RoleIngest : the ingest endpoint only, e.g. for log shippers
+	RoleIngest = "ingest"
+
+	// RoleAdmin : the ingest and admin endpoints, along with the query ones
+	RoleAdmin = "admin"
+)
+
+// APIKey : a key granted a role, sent as an X-API-Key header or as a bearer token
+type APIKey struct {
+	Name string `json:"name"` // who the key was given to
+	Key  string `json:"key"`
+	Role string `json:"role"` // query | ingest | admin
+
+	RateLimit float64 `json:"rateLimit"` // requests per second, unlimited when 0
+	Burst     int     `json:"burst"`     // requests allowed at once before the rate applies, 1 by default
+}
+
+// Grants : whether the key opens the endpoints of role
+func (key APIKey) Grants(role string) bool {
+	return key.Role == role || key.Role == RoleAdmin
+}
+
+// BearerToken : the token of an Authorization header using the Bearer scheme, whatever its case.
+// Any other header carries no token, and "" is returned.
+func BearerToken(authorization string) string {
+	const scheme = "Bearer "
+	if len(authorization) < len(scheme) || !strings.EqualFold(authorization[:len(scheme)], scheme) {
+		return ""
+	}
+
+	return authorization[len(scheme):]
+}
+
+// FindAPIKey : the API key matching key, if any
+func (config *Config) FindAPIKey(key string) (APIKey, bool) {
+	for _, apiKey := range config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey.Key)) == 1 {
+			return apiKey, true
+		}
+	}
+
+	return APIKey{}, false
+}
+
+// Duration : a time.Duration, written as a string in JSON (e.g. "10s", "1m30s")
+type Duration time.Duration
+
+// UnmarshalJSON : parses a duration string
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return errors.New("A duration should be a string such as \"10s\", not " + string(data))
+	}
+
+	parsed, err := time.ParseDuration(str)
+	if err != nil {
+		return errors.New("Invalid duration : " + str)
+	}
+
+	*duration = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON : writes the duration as a string
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+// Source : an input file to index, and the format of its lines.
+// Options that do not apply to the format are ignored.
+type Source struct {
+	Path   string `json:"path"`
+	Format string `json:"format"` // tsv | csv | jsonl | clf, see parser.FormatFromName
+
+	Layouts    []string `json:"layouts"`    // tsv, csv, jsonl : accepted date layouts, parser.DefaultLayouts when empty
+	TimeColumn *int     `json:"timeColumn"` // csv : column of the date, 0 by default
+	URLColumn  *int     `json:"urlColumn"`  // csv : column of the url, 1 by default
+	TimeField  string   `json:"timeField"`  // jsonl : path of the date field, "time" by default
+	URLField   string   `json:"urlField"`   // jsonl : path of the url field, "url" by default
+	QueryParam string   `json:"queryParam"` // clf : request parameter holding the query, the whole request path when empty
+
+	AttributeColumns map[string]int    `json:"attributeColumns"` // tsv, csv : attribute name -> column
+	AttributeFields  map[string]string `json:"attributeFields"`  // jsonl : attribute name -> field path, clf : attribute name -> one of parser.CLFFields
+}
+
+// Default : the configuration used when no file is given, indexing ./hn_logs.tsv
+func Default() *Config {
+	return &Config{
+		Sources:        []Source{{Path: "./hn_logs.tsv", Format: DefaultFormat}},
+		Address:        ":8080",
+		DrainTimeout:   Duration(10 * time.Second),
+		ReadTimeout:    Duration(time.Minute),
+		RequestTimeout: Duration(30 * time.Second),
+		Gzip:           true,
+		AccessLog:      true,
+		DefaultSize:    DefaultSize,
+		MaxSize:        MaxSize,
+		CacheSize:      CacheSize,
+		MaxIngestBytes: MaxIngestBytes,
+	}
+}
+
+// Sizes : the default and maximum sizes of the popular endpoint, falling back to DefaultSize and MaxSize when not set
+func (config *Config) Sizes() (int, int) {
+	defaultSize, maxSize := config.DefaultSize, config.MaxSize
+	if defaultSize <= 0 {
+		defaultSize = DefaultSize
+	}
+	if maxSize <= 0 {
+		maxSize = MaxSize
+	}
+	if defaultSize > maxSize {
+		defaultSize = maxSize
+	}
+
+	return defaultSize, maxSize
+}
+
+// Load : reads the configuration from a JSON file
+func Load(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("Could not open configuration file : " + err.Error())
+	}
+	defer file.Close()
+
+	// Sources are decoded into a slice of their own : decoding into the default one would fill
+	// the missing fields of the first source with those of ./hn_logs.tsv
+	config := Default()
+	config.Sources = nil
+	if err := json.NewDecoder(file).Decode(config); err != nil {
+		return nil, errors.New("Could not parse configuration file " + path + " : " + err.Error())
+	}
+	if config.Sources == nil {
+		config.Sources = Default().Sources
+	}
+
+	if config.DefaultSize < 1 || config.MaxSize < 1 {
+		return nil, errors.New("Invalid configuration file " + path + " : defaultSize and maxSize should be positive")
+	}
+	if config.DefaultSize > config.MaxSize {
+		return nil, errors.New("Invalid configuration file " + path + " : defaultSize should not be greater than maxSize")
+	}
+	if config.ReadTimeout < 0 || config.RequestTimeout < 0 {
+		return nil, errors.New("Invalid configuration file " + path + " : readTimeout and requestTimeout should not be negative")
+	}
+	if _, err := logging.ParseLevel(config.Log.Level); err != nil {
+		return nil, errors.New("Invalid configuration file " + path + " : " + err.Error())
+	}
+	if config.CacheSize < 0 || config.MaxIngestBytes < 0 {
+		return nil, errors.New("Invalid configuration file " + path + " : cacheSize and maxIngestBytes should not be negative")
+	}
+
+	keys := make(map[string]bool, len(config.APIKeys))
+	for _, apiKey := range config.APIKeys {
+		if apiKey.Key == "" || keys[apiKey.Key] {
+			return nil, errors.New("Invalid API key " + apiKey.Name + " : keys should not be empty nor shared")
+		}
+		if apiKey.Role != RoleQuery && apiKey.Role != RoleIngest && apiKey.Role != RoleAdmin {
+			return nil, errors.New("Invalid API key " + apiKey.Name + " : unknown role " + apiKey.Role + ", should be " + RoleQuery + ", " + RoleIngest + " or " + RoleAdmin)
+		}
+		if apiKey.RateLimit < 0 || apiKey.Burst < 0 {
+			return nil, errors.New("Invalid API key " + apiKey.Name + " : rateLimit and burst should not be negative")
+		}
+		keys[apiKey.Key] = true
+	}
+
+	for i, source := range config.Sources {
+		if source.Path == "" {
+			return nil, errors.New("Invalid source " + strconv.Itoa(i) + " : a path is required")
+		}
+		if source.Format == "" {
+			config.Sources[i].Format = DefaultFormat
+		}
+		if _, err := source.Parser(); err != nil {
+			return nil, errors.New("Invalid source " + source.Path + " : " + err.Error())
+		}
+	}
+
+	return config, nil
+}
+
+// Parser : the format to parse the lines of the source with, set up with the source options
+func (source Source) Parser() (parser.Format, error) {
+	format, err := parser.FormatFromName(source.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typed := format.(type) {
+	case *parser.TSVFormat:
+		typed.Layouts = source.Layouts
+		typed.AttributeColumns = source.AttributeColumns
+	case *parser.CSVFormat:
+		typed.Layouts = source.Layouts
+		typed.AttributeColumns = source.AttributeColumns
+		if source.TimeColumn != nil {
+			typed.TimeColumn = *source.TimeColumn
+		}
+		if source.URLColumn != nil {
+			typed.URLColumn = *source.URLColumn
+		}
+	case *parser.JSONLFormat:
+		typed.Layouts = source.Layouts
+		typed.AttributeFields = source.AttributeFields
+		if source.TimeField != "" {
+			typed.TimeField = source.TimeField
+		}
+		if source.URLField != "" {
+			typed.URLField = source.URLField
+		}
+	case *parser.CLFFormat:
+		typed.QueryParam = source.QueryParam
+		typed.AttributeFields = source.AttributeFields
+		for _, field := range source.AttributeFields {
+			if !isCLFField(field) {
+				return nil, errors.New("Unknown clf field : " + field + ". Supported fields are " + strings.Join(parser.CLFFields, ", "))
+			}
+		}
+	}
+
+	return format, nil
+}
+
+func isCLFField(field string) bool {
+	for _, clfField := range parser.CLFFields {
+		if field == clfField {
+			return true
+		}
+	}
+
+	return false
+}
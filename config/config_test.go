@@ -0,0 +1,210 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/parser"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	directory, err := ioutil.TempDir("", "hn-queries")
+	assert.NoError(t, err, "Temporary directory should have been created")
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	path := filepath.Join(directory, "config.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644), "Configuration should have been written")
+	return path
+}
+
+func Test_Default_ShouldIndexHNLogs(t *testing.T) {
+	config := Default()
+	assert.Equal(t, []Source{{Path: "./hn_logs.tsv", Format: "tsv"}}, config.Sources, "hn_logs.tsv should be indexed by default")
+	assert.Equal(t, ":8080", config.Address, "Server should listen on port 8080 by default")
+	assert.Equal(t, Duration(10*time.Second), config.DrainTimeout, "Requests should be drained for 10s by default")
+	assert.Equal(t, 10, config.DefaultSize, "10 queries should be returned by default")
+	assert.Equal(t, 1000, config.MaxSize, "1000 queries should be returned at most by default")
+	assert.Equal(t, int64(32<<20), config.MaxIngestBytes, "Ingestion bodies should hold 32 MiB at most by default")
+}
+
+func Test_Sizes_ShouldFallBackToDefaults(t *testing.T) {
+	defaultSize, maxSize := (&Config{}).Sizes()
+	assert.Equal(t, DefaultSize, defaultSize, "Default size should fall back to DefaultSize")
+	assert.Equal(t, MaxSize, maxSize, "Max size should fall back to MaxSize")
+
+	defaultSize, maxSize = (&Config{DefaultSize: 50, MaxSize: 20}).Sizes()
+	assert.Equal(t, 20, defaultSize, "Default size should not exceed max size")
+	assert.Equal(t, 20, maxSize, "Max size should be kept")
+}
+
+func Test_Load_ShouldReadServerSettings(t *testing.T) {
+	config, err := Load(writeConfig(t, `{"address": "localhost:9090", "grpcAddress": "localhost:9091", "drainTimeout": "1m30s", "snapshotPath": "/tmp/index.snapshot"}`))
+	assert.NoError(t, err, "A valid configuration should be loaded")
+	assert.Equal(t, "localhost:9090", config.Address, "Address should be read")
+	assert.Equal(t, "localhost:9091", config.GRPCAddress, "gRPC address should be read")
+	assert.Equal(t, Duration(90*time.Second), config.DrainTimeout, "Drain timeout should be read")
+	assert.Equal(t, "/tmp/index.snapshot", config.SnapshotPath, "Snapshot path should be read")
+	assert.False(t, config.LoadSnapshot, "The snapshot should not be read on startup unless asked to")
+	assert.Equal(t, Default().Sources, config.Sources, "Missing settings should keep their default value")
+
+	config, err = Load(writeConfig(t, `{"snapshotPath": "/tmp/index.snapshot", "loadSnapshot": true}`))
+	assert.NoError(t, err, "A valid configuration should be loaded")
+	assert.True(t, config.LoadSnapshot, "Reading the snapshot on startup should be read")
+
+	_, err = Load(writeConfig(t, `{"drainTimeout": "soon"}`))
+	assert.Error(t, err, "An invalid duration should not be loaded")
+
+	_, err = Load(writeConfig(t, `{"drainTimeout": 10}`))
+	assert.Error(t, err, "A duration should be a string")
+
+	config, err = Load(writeConfig(t, `{"defaultSize": 5, "maxSize": 50}`))
+	assert.NoError(t, err, "Valid sizes should be loaded")
+	assert.Equal(t, 5, config.DefaultSize, "Default size should be read")
+	assert.Equal(t, 50, config.MaxSize, "Max size should be read")
+
+	_, err = Load(writeConfig(t, `{"maxSize": 0}`))
+	assert.Error(t, err, "A non positive max size should not be loaded")
+
+	_, err = Load(writeConfig(t, `{"defaultSize": 100, "maxSize": 50}`))
+	assert.Error(t, err, "A default size greater than max size should not be loaded")
+
+	config, err = Load(writeConfig(t, `{"cacheSize": 0}`))
+	assert.NoError(t, err, "A cache size of 0 should be loaded")
+	assert.Equal(t, 0, config.CacheSize, "Cache size should be read")
+
+	_, err = Load(writeConfig(t, `{"cacheSize": -1}`))
+	assert.Error(t, err, "A negative cache size should not be loaded")
+}
+
+func Test_Load_ShouldReadAPIKeys(t *testing.T) {
+	config, err := Load(writeConfig(t, `{"apiKeys": [{"name": "dashboard", "key": "foo", "role": "query", "rateLimit": 2.5, "burst": 5}, {"name": "ops", "key": "bar", "role": "admin"}, {"name": "shipper", "key": "qux", "role": "ingest"}]}`))
+	assert.NoError(t, err, "Valid API keys should be loaded")
+	assert.Equal(t, []APIKey{{"dashboard", "foo", RoleQuery, 2.5, 5}, {"ops", "bar", RoleAdmin, 0, 0}, {"shipper", "qux", RoleIngest, 0, 0}}, config.APIKeys, "API keys should be read")
+
+	key, found := config.FindAPIKey("bar")
+	assert.True(t, found, "A configured key should be found")
+	assert.Equal(t, "ops", key.Name, "The matching key should be found")
+	_, found = config.FindAPIKey("baz")
+	assert.False(t, found, "A key not configured should not be found")
+
+	for _, apiKeys := range []string{
+		`[{"name": "dashboard", "key": "", "role": "query"}]`,
+		`[{"name": "dashboard", "key": "foo", "role": "query"}, {"name": "ops", "key": "foo", "role": "admin"}]`,
+		`[{"name": "dashboard", "key": "foo", "role": "root"}]`,
+		`[{"name": "dashboard", "key": "foo", "role": "query", "rateLimit": -1}]`,
+	} {
+		_, err = Load(writeConfig(t, `{"apiKeys": `+apiKeys+`}`))
+		assert.Error(t, err, "Invalid API keys should not be loaded : "+apiKeys)
+	}
+}
+
+func Test_Load_ShouldReadMiddlewareSettings(t *testing.T) {
+	config, err := Load(writeConfig(t, `{"readTimeout": "5s", "requestTimeout": "1s", "gzip": false, "accessLog": false,
+		"cors": {"allowedOrigins": ["https://dashboard.example.com"], "maxAge": "10m"}}`))
+	assert.NoError(t, err, "Valid middleware settings should be loaded")
+	assert.Equal(t, Duration(5*time.Second), config.ReadTimeout, "Read timeout should be read")
+	assert.Equal(t, Duration(time.Second), config.RequestTimeout, "Request timeout should be read")
+	assert.False(t, config.Gzip, "Gzip should be read")
+	assert.False(t, config.AccessLog, "Access log should be read")
+	assert.Equal(t, []string{"https://dashboard.example.com"}, config.CORS.AllowedOrigins, "Allowed origins should be read")
+	assert.Equal(t, Duration(10*time.Minute), config.CORS.MaxAge, "CORS max age should be read")
+
+	_, err = Load(writeConfig(t, `{"requestTimeout": "-1s"}`))
+	assert.Error(t, err, "A negative timeout should not be loaded")
+
+	config, err = Load(writeConfig(t, `{"log": {"level": "debug", "output": "stderr"}}`))
+	assert.NoError(t, err, "Valid log settings should be loaded")
+	assert.Equal(t, Log{"debug", "stderr"}, config.Log, "Log settings should be read")
+
+	_, err = Load(writeConfig(t, `{"log": {"level": "verbose"}}`))
+	assert.Error(t, err, "An unknown log level should not be loaded")
+}
+
+func Test_CORS_ShouldAllowConfiguredOrigins(t *testing.T) {
+	cors := CORS{AllowedOrigins: []string{"https://dashboard.example.com"}}
+	assert.True(t, cors.Allows("https://dashboard.example.com"), "A configured origin should be allowed")
+	assert.False(t, cors.Allows("https://evil.example.com"), "Another origin should not be allowed")
+	assert.True(t, CORS{AllowedOrigins: []string{"*"}}.Allows("https://evil.example.com"), "Any origin should be allowed with *")
+	assert.False(t, CORS{}.Allows("https://dashboard.example.com"), "No origin should be allowed by default")
+
+	assert.Equal(t, DefaultAllowedMethods, cors.Methods(), "Methods should fall back to the default ones")
+	assert.Equal(t, []string{"GET"}, CORS{AllowedMethods: []string{"GET"}}.Methods(), "Configured methods should be allowed")
+}
+
+func Test_APIKey_Grants_ShouldGrantQueriesToAdmins(t *testing.T) {
+	assert.True(t, APIKey{Role: RoleQuery}.Grants(RoleQuery), "A query key should open the query endpoints")
+	assert.False(t, APIKey{Role: RoleQuery}.Grants(RoleAdmin), "A query key should not open the admin endpoints")
+	assert.True(t, APIKey{Role: RoleAdmin}.Grants(RoleQuery), "An admin key should open the query endpoints")
+	assert.True(t, APIKey{Role: RoleAdmin}.Grants(RoleAdmin), "An admin key should open the admin endpoints")
+	assert.True(t, APIKey{Role: RoleAdmin}.Grants(RoleIngest), "An admin key should open ingestion")
+	assert.True(t, APIKey{Role: RoleIngest}.Grants(RoleIngest), "An ingest key should open ingestion")
+	assert.False(t, APIKey{Role: RoleIngest}.Grants(RoleQuery), "An ingest key should not open the query endpoints")
+	assert.False(t, APIKey{Role: RoleQuery}.Grants(RoleIngest), "A query key should not open ingestion")
+}
+
+func Test_BearerToken_ShouldRequireBearerScheme(t *testing.T) {
+	assert.Equal(t, "secret", BearerToken("Bearer secret"), "The token should follow the Bearer scheme")
+	assert.Equal(t, "secret", BearerToken("bEARER secret"), "The scheme should be case-insensitive")
+	assert.Equal(t, "", BearerToken("secret"), "A header without scheme should carry no token")
+	assert.Equal(t, "", BearerToken("Basic secret"), "A header of another scheme should carry no token")
+	assert.Equal(t, "", BearerToken("Bearer"), "A scheme without token should carry no token")
+}
+
+func Test_Load_ShouldReadSources(t *testing.T) {
+	path := writeConfig(t, `{"sources": [
+		{"path": "queries.csv", "format": "csv", "timeColumn": 2, "urlColumn": 0},
+		{"path": "queries.jsonl", "format": "jsonl", "urlField": "request.query", "layouts": ["2006-01-02"]},
+		{"path": "access.log", "format": "clf", "queryParam": "q", "attributeFields": {"from": "referrer"}},
+		{"path": "hn_logs.tsv", "attributeColumns": {"country": 2}}
+	]}`)
+
+	config, err := Load(path)
+	assert.NoError(t, err, "A valid configuration should be loaded")
+	assert.Equal(t, 4, len(config.Sources), "Every source should be loaded")
+
+	csvFormat, _ := config.Sources[0].Parser()
+	assert.Equal(t, &parser.CSVFormat{TimeColumn: 2, URLColumn: 0}, csvFormat, "CSV options should be applied")
+
+	jsonlFormat, _ := config.Sources[1].Parser()
+	assert.Equal(t, &parser.JSONLFormat{TimeField: "time", URLField: "request.query", Layouts: []string{"2006-01-02"}}, jsonlFormat, "JSONL options should be applied")
+
+	clfFormat, _ := config.Sources[2].Parser()
+	assert.Equal(t, &parser.CLFFormat{QueryParam: "q", AttributeFields: map[string]string{"from": "referrer"}}, clfFormat, "CLF options should be applied")
+
+	tsvFormat, _ := config.Sources[3].Parser()
+	assert.Equal(t, &parser.TSVFormat{AttributeColumns: map[string]int{"country": 2}}, tsvFormat, "TSV is the default format")
+}
+
+func Test_Load_Sources_ShouldNotInheritDefaultSource(t *testing.T) {
+	config, err := Load(writeConfig(t, `{"sources": [{"path": "queries.tsv"}, {"path": "queries.csv", "format": "csv"}]}`))
+	assert.NoError(t, err, "A valid configuration should be loaded")
+	assert.Equal(t, []Source{{Path: "queries.tsv", Format: DefaultFormat}, {Path: "queries.csv", Format: "csv"}}, config.Sources, "Sources should only hold what was configured, and the default format")
+
+	config, err = Load(writeConfig(t, `{"sources": []}`))
+	assert.NoError(t, err, "A configuration without sources should be loaded")
+	assert.Empty(t, config.Sources, "No source should be indexed when none is configured")
+
+	_, err = Load(writeConfig(t, `{"sources": [{"format": "csv"}]}`))
+	assert.Error(t, err, "A source without a path should not take the one of the default source")
+}
+
+func Test_Load_ShouldFail(t *testing.T) {
+	_, err := Load("/does/not/exist.json")
+	assert.Error(t, err, "A missing file should not be loaded")
+
+	_, err = Load(writeConfig(t, `not json`))
+	assert.Error(t, err, "An invalid file should not be loaded")
+
+	_, err = Load(writeConfig(t, `{"maxIngestBytes": -1}`))
+	assert.Error(t, err, "A negative ingestion limit should not be loaded")
+
+	_, err = Load(writeConfig(t, `{"sources": [{"path": "queries.xml", "format": "xml"}]}`))
+	assert.Error(t, err, "A source with an unknown format should not be loaded")
+
+	_, err = Load(writeConfig(t, `{"sources": [{"path": "access.log", "format": "clf", "attributeFields": {"country": "geo"}}]}`))
+	assert.Error(t, err, "A source with an unknown clf field should not be loaded")
+}
@@ -4,6 +4,9 @@ const (
 	// DateFormat is the date format in which we expect HN dates
 	DateFormat = "2006-01-02 15:04:05"
 
+	// CLFDateFormat is the date format of Common and Combined Log Format lines
+	CLFDateFormat = "02/Jan/2006:15:04:05 -0700"
+
 	// Tab : tabulation constant
 	Tab = "	"
 
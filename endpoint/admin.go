@@ -0,0 +1,150 @@
+package endpoint
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/ingestion"
+	"github.com/thomaspepio/hn-queries/logging"
+)
+
+// ReindexStatus : the state of the last re-indexing
+type ReindexStatus struct {
+	Running    bool              `json:"running"`
+	Progress   *ingestion.Status `json:"progress,omitempty"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// reindexer : builds fresh indexes from the configured sources, one at a time
+type reindexer struct {
+	sync.Mutex
+	progress   *ingestion.Progress
+	running    bool
+	finishedAt *time.Time
+	err        error
+}
+
+// adminOnly : rejects requests carrying neither an admin API key nor the admin token as a bearer token.
+// Every request is rejected when neither of them is configured.
+func adminOnly(server *Server) gin.HandlerFunc {
+	return restricted(server, config.RoleAdmin, &APIError{Code: CodeAdminDisabled,
+		Message: "Admin endpoints are disabled : neither an admin token nor an admin API key is configured", status: http.StatusForbidden})
+}
+
+// ingestOnly : rejects requests carrying neither an API key granted ingestion nor the admin token as a bearer token.
+// Every request is rejected when neither of them is configured, so that nobody can write to the index of a fresh deployment.
+func ingestOnly(server *Server) gin.HandlerFunc {
+	return restricted(server, config.RoleIngest, &APIError{Code: CodeIngestDisabled,
+		Message: "Ingestion is disabled : neither an admin token nor an ingest or admin API key is configured", status: http.StatusForbidden})
+}
+
+// restricted : rejects requests carrying neither an API key granted role nor the admin token as a bearer token,
+// answering disabled when neither of them is configured
+func restricted(server *Server, role string, disabled *APIError) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		configuration := server.config()
+		if key, found := configuration.FindAPIKey(presentedKey(context)); found {
+			if server.authorize(context, key, role) {
+				context.Next()
+			}
+			return
+		}
+
+		adminToken := configuration.AdminToken
+		if adminToken == "" && !hasKeyGranting(configuration, role) {
+			abort(context, disabled)
+			return
+		}
+
+		token := config.BearerToken(context.GetHeader("Authorization"))
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			abort(context, &APIError{Code: CodeUnauthorized, Message: "Missing or wrong API key or admin token", status: http.StatusUnauthorized})
+			return
+		}
+
+		context.Next()
+	}
+}
+
+func hasKeyGranting(configuration *config.Config, role string) bool {
+	for _, key := range configuration.APIKeys {
+		if key.Grants(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// start : builds a fresh index in the background, then swaps it for the live one.
+// The live index keeps serving queries until the fresh one is ready. Queries ingested in the meantime are added to the fresh one as well.
+func (reindexer *reindexer) start(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		reindexer.Lock()
+		defer reindexer.Unlock()
+
+		if reindexer.running {
+			context.JSON(http.StatusConflict, reindexer.snapshot())
+			return
+		}
+
+		progress := ingestion.NewProgress()
+		progress.Observe(server.metrics.ObserveLine)
+		reindexer.progress = progress
+		reindexer.running = true
+		reindexer.finishedAt = nil
+		reindexer.err = nil
+		server.live.keepIngested()
+
+		sources := server.config().Sources
+		logger := logging.Component("reindex").With(logging.Fields{"request_id": context.GetString(requestIDKey)})
+		logger.Info("Re-indexing started", logging.Fields{"sources": len(sources)})
+		go func() {
+			index, err := ingestion.Ingest(sources, progress)
+			if err == nil {
+				server.live.swapKeeping(index)
+				logger.Info("Re-indexing done, index swapped", logging.Fields{"lines_indexed": progress.Status().LinesIndexed})
+			} else {
+				server.live.dropIngested()
+				logger.Error("Re-indexing failed, keeping the current index", logging.Fields{"error": err})
+			}
+
+			reindexer.Lock()
+			finishedAt := time.Now()
+			reindexer.running = false
+			reindexer.finishedAt = &finishedAt
+			reindexer.err = err
+			reindexer.Unlock()
+		}()
+
+		context.JSON(http.StatusAccepted, reindexer.snapshot())
+	}
+}
+
+// status : reports the progress of the running re-indexing, or the outcome of the last one
+func (reindexer *reindexer) status(context *gin.Context) {
+	reindexer.Lock()
+	defer reindexer.Unlock()
+
+	context.JSON(http.StatusOK, reindexer.snapshot())
+}
+
+func (reindexer *reindexer) snapshot() ReindexStatus {
+	status := ReindexStatus{Running: reindexer.running, FinishedAt: reindexer.finishedAt}
+
+	if reindexer.progress != nil {
+		progress := reindexer.progress.Status()
+		status.Progress = &progress
+	}
+
+	if reindexer.err != nil {
+		status.Error = reindexer.err.Error()
+	}
+
+	return status
+}
@@ -0,0 +1,138 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+)
+
+func serveAsAdmin(router *gin.Engine, method, target, token string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_Admin_WithoutToken_ShouldBeDisabled(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+	response := serveAsAdmin(router, http.MethodPost, "/1/admin/reindex", "")
+	assert.Equal(t, http.StatusForbidden, response.Code, "Admin endpoints should be disabled without admin token")
+}
+
+func Test_Admin_WrongToken_ShouldBeRejected(t *testing.T) {
+	router := Router(index.EmptyIndex(), &config.Config{AdminToken: "secret"})
+
+	response := serveAsAdmin(router, http.MethodGet, "/1/admin/reindex", "not-the-secret")
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "A wrong token should be rejected")
+
+	response = serve(router, http.MethodGet, "/1/admin/reindex")
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "A missing token should be rejected")
+
+	response = serveWithHeaders(router, "/1/admin/reindex", map[string]string{"Authorization": "secret"})
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "A token sent without the Bearer scheme should be rejected")
+}
+
+func Test_Admin_Reindex_ShouldSwapIndex(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "hn-queries")
+	defer os.RemoveAll(directory)
+	source := filepath.Join(directory, "hn_logs.tsv")
+	ioutil.WriteFile(source, []byte(constant.CorrectLine+"\n"+constant.DateAsString+constant.Tab+"http://other-url\n"), 0644)
+
+	router := Router(index.EmptyIndex(), &config.Config{Sources: []config.Source{{Path: source}}, AdminToken: "secret"})
+	response := serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.JSONEq(t, `{"count": 0}`, response.Body.String(), "Nothing should be indexed before re-indexing")
+
+	response = serveAsAdmin(router, http.MethodPost, "/1/admin/reindex", "secret")
+	assert.Equal(t, http.StatusAccepted, response.Code, "Re-indexing should have started")
+
+	var status ReindexStatus
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		response = serveAsAdmin(router, http.MethodGet, "/1/admin/reindex", "secret")
+		json.Unmarshal(response.Body.Bytes(), &status)
+		if !status.Running {
+			break
+		}
+	}
+
+	assert.False(t, status.Running, "Re-indexing should be over")
+	assert.Empty(t, status.Error, "Re-indexing should have succeeded")
+	assert.Equal(t, int64(2), status.Progress.LinesIndexed, "Two lines should have been indexed")
+	assert.NotNil(t, status.FinishedAt, "Re-indexing end should be reported")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.JSONEq(t, `{"count": 2}`, response.Body.String(), "The fresh index should be served")
+}
+
+func Test_Admin_Reindex_Failure_ShouldKeepIndex(t *testing.T) {
+	router := Router(index.EmptyIndex(), &config.Config{Sources: []config.Source{{Path: "/does/not/exist.tsv"}}, AdminToken: "secret"})
+
+	serveAsAdmin(router, http.MethodPost, "/1/admin/reindex", "secret")
+
+	var status ReindexStatus
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		response := serveAsAdmin(router, http.MethodGet, "/1/admin/reindex", "secret")
+		json.Unmarshal(response.Body.Bytes(), &status)
+		if !status.Running {
+			break
+		}
+	}
+
+	assert.Contains(t, status.Error, "/does/not/exist.tsv", "The failure should be reported")
+
+	response := serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.Equal(t, http.StatusOK, response.Code, "The former index should still be served")
+}
+
+func Test_Admin_Reindex_ShouldKeepQueriesIngestedMeanwhile(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), ingestConfig())
+
+	// As re-indexing does once started, until the fresh index is ready
+	server.live.keepIngested()
+	post(server.Router, "/1/ingest", "text/plain", constant.CorrectLine)
+
+	fresh := index.EmptyIndex()
+	addQuery(fresh, time.Date(2015, 8, 1, 0, 0, 0, 0, time.UTC), "http://other-url")
+	server.live.swapKeeping(fresh)
+
+	response := serve(server.Router, http.MethodGet, "/1/queries/count/2015")
+	assert.JSONEq(t, `{"count": 2}`, response.Body.String(), "Queries ingested while re-indexing should be added to the fresh index")
+
+	post(server.Router, "/1/ingest", "text/plain", constant.DateAsString+constant.Tab+"http://third-url")
+	assert.Nil(t, server.live.ingested, "Queries should not be kept once the fresh index is swapped in")
+}
+
+func Test_Server_Reload_ShouldApplyAdminToken(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), config.Default())
+
+	response := serveAsAdmin(server.Router, http.MethodGet, "/1/admin/reindex", "secret")
+	assert.Equal(t, http.StatusForbidden, response.Code, "Admin endpoints should be disabled without admin token")
+
+	server.Reload(&config.Config{AdminToken: "secret"})
+	response = serveAsAdmin(server.Router, http.MethodGet, "/1/admin/reindex", "secret")
+	assert.Equal(t, http.StatusOK, response.Code, "The reloaded admin token should be accepted")
+}
+
+func Test_Server_WriteSnapshot_ShouldWriteServedIndex(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), ingestConfig())
+	post(server.Router, "/1/ingest", "text/tab-separated-values", constant.CorrectLine)
+
+	var buffer bytes.Buffer
+	assert.NoError(t, server.WriteSnapshot(&buffer), "Snapshot should have been written")
+
+	restored, err := index.ReadSnapshot(&buffer)
+	assert.NoError(t, err, "Snapshot should have been read")
+	assert.Equal(t, 1, len(restored.URLsToID), "The ingested query should be in the snapshot")
+}
@@ -0,0 +1,71 @@
+package endpoint
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/config"
+)
+
+const (
+	// The header carrying the API key, which can also be sent as a bearer token
+	apiKeyHeader = "X-API-Key"
+
+	// Where the name of the API key of a request is kept in its context
+	apiKeyName = "apiKey"
+)
+
+// presentedKey : the API key the request carries, from the X-API-Key header or else as a bearer token
+func presentedKey(context *gin.Context) string {
+	if key := context.GetHeader(apiKeyHeader); key != "" {
+		return key
+	}
+
+	return config.BearerToken(context.GetHeader("Authorization"))
+}
+
+// authenticate : rejects requests whose API key does not grant role, and limits the rate of the others to the one of their key.
+// Every request is let through when no API key is configured.
+func authenticate(server *Server, role string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		configuration := server.config()
+		if len(configuration.APIKeys) == 0 {
+			context.Next()
+			return
+		}
+
+		key, found := configuration.FindAPIKey(presentedKey(context))
+		if !found {
+			abort(context, &APIError{Code: CodeUnauthorized, Message: "Missing or unknown API key", status: http.StatusUnauthorized})
+			return
+		}
+
+		if server.authorize(context, key, role) {
+			context.Next()
+		}
+	}
+}
+
+// authorize : checks key grants role and takes a token from its bucket, answering 403 or 429 when it does not.
+// Handlers must return right away when it does not.
+func (server *Server) authorize(context *gin.Context, key config.APIKey, role string) bool {
+	if !key.Grants(role) {
+		abort(context, &APIError{Code: CodeForbidden, Message: "The API key " + key.Name + " is not granted the " + role + " role", status: http.StatusForbidden})
+		return false
+	}
+
+	allowed, wait := server.limiter.Take(key.Key, key.RateLimit, key.Burst, time.Now())
+	if !allowed {
+		retryAfter := int(math.Max(1, math.Ceil(wait.Seconds())))
+		context.Header("Retry-After", strconv.Itoa(retryAfter))
+		abort(context, &APIError{Code: CodeRateLimited, Message: "Too many requests for the API key " + key.Name,
+			Details: gin.H{"rateLimit": key.RateLimit, "retryAfter": retryAfter}, status: http.StatusTooManyRequests})
+		return false
+	}
+
+	context.Set(apiKeyName, key.Name)
+	return true
+}
@@ -0,0 +1,124 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/index"
+)
+
+func withKeys(keys ...config.APIKey) *config.Config {
+	configuration := config.Default()
+	configuration.APIKeys = keys
+	return configuration
+}
+
+func Test_Authenticate_WithoutKeys_ShouldOnlyOpenQueries(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	response := serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.Equal(t, http.StatusOK, response.Code, "Queries should be open when no API key is configured")
+
+	response = post(router, "/1/ingest", "text/plain", "")
+	assert.Equal(t, http.StatusForbidden, response.Code, "Ingestion should be closed when neither an API key nor an admin token is configured")
+	assert.Equal(t, CodeIngestDisabled, apiError(response.Body.Bytes()).Code, "Ingestion should be told disabled")
+
+	router = Router(index.EmptyIndex(), ingestConfig())
+	response = post(router, "/1/ingest", "text/plain", "")
+	assert.Equal(t, http.StatusOK, response.Code, "Ingestion should be opened by the admin token")
+
+	response = serveAsAdmin(router, http.MethodPost, "/1/ingest", "not-the-token")
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "Ingestion should expect the admin token")
+}
+
+func Test_Authenticate_IngestKey_ShouldOnlyOpenIngestion(t *testing.T) {
+	router := Router(index.EmptyIndex(), withKeys(config.APIKey{Name: "shipper", Key: "ingest-key", Role: config.RoleIngest}))
+
+	response := serveAsAdmin(router, http.MethodPost, "/1/ingest", "ingest-key")
+	assert.Equal(t, http.StatusOK, response.Code, "An ingest key should open ingestion")
+
+	response = serveAsAdmin(router, http.MethodGet, "/1/queries/count/2015", "ingest-key")
+	assert.Equal(t, http.StatusForbidden, response.Code, "An ingest key should not open the query endpoints")
+
+	response = serveAsAdmin(router, http.MethodPost, "/1/admin/reindex", "ingest-key")
+	assert.Equal(t, http.StatusForbidden, response.Code, "An ingest key should not trigger re-indexing")
+}
+
+func Test_Authenticate_ShouldCheckKeyAndRole(t *testing.T) {
+	router := Router(index.EmptyIndex(), withKeys(
+		config.APIKey{Name: "dashboard", Key: "query-key", Role: config.RoleQuery},
+		config.APIKey{Name: "ops", Key: "admin-key", Role: config.RoleAdmin},
+	))
+
+	response := serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "A missing key should be rejected")
+
+	response = serveWithHeaders(router, "/1/queries/count/2015", map[string]string{apiKeyHeader: "unknown-key"})
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "An unknown key should be rejected")
+
+	response = serveWithHeaders(router, "/1/queries/count/2015", map[string]string{apiKeyHeader: "query-key"})
+	assert.Equal(t, http.StatusOK, response.Code, "A query key should open the query endpoints")
+
+	response = serveAsAdmin(router, http.MethodGet, "/1/queries/popular/2015", "admin-key")
+	assert.Equal(t, http.StatusOK, response.Code, "An admin key sent as a bearer token should open the query endpoints")
+
+	response = serveAsAdmin(router, http.MethodPost, "/1/ingest", "query-key")
+	assert.Equal(t, http.StatusForbidden, response.Code, "A query key should not open ingestion")
+	assert.Equal(t, CodeForbidden, apiError(response.Body.Bytes()).Code, "A key lacking the role should be forbidden")
+
+	response = serveAsAdmin(router, http.MethodPost, "/1/ingest", "admin-key")
+	assert.Equal(t, http.StatusOK, response.Code, "An admin key should open ingestion")
+
+	response = serveAsAdmin(router, http.MethodGet, "/1/admin/reindex", "query-key")
+	assert.Equal(t, http.StatusForbidden, response.Code, "A query key should not open the admin endpoints")
+
+	response = serveAsAdmin(router, http.MethodGet, "/1/admin/reindex", "admin-key")
+	assert.Equal(t, http.StatusOK, response.Code, "An admin key should open the admin endpoints, even without admin token")
+
+	response = serve(router, http.MethodGet, "/healthz")
+	assert.Equal(t, http.StatusOK, response.Code, "Health checks should stay open")
+}
+
+func Test_Authenticate_ShouldRequireBearerScheme(t *testing.T) {
+	router := Router(index.EmptyIndex(), withKeys(config.APIKey{Name: "ops", Key: "admin-key", Role: config.RoleAdmin}))
+
+	response := serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Authorization": "admin-key"})
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "A key sent without the Bearer scheme should be rejected")
+
+	response = serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Authorization": "Basic admin-key"})
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "A key sent with another scheme should be rejected")
+
+	response = serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Authorization": "bearer admin-key"})
+	assert.Equal(t, http.StatusOK, response.Code, "The Bearer scheme should be case-insensitive")
+
+	response = serveWithHeaders(router, "/1/admin/reindex", map[string]string{"Authorization": "admin-key"})
+	assert.Equal(t, http.StatusUnauthorized, response.Code, "An admin key sent without the Bearer scheme should be rejected")
+}
+
+func Test_Authenticate_AboveRate_ShouldBeLimited(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), withKeys(config.APIKey{Name: "dashboard", Key: "query-key", Role: config.RoleQuery, RateLimit: 0.5, Burst: 2}))
+	headers := map[string]string{apiKeyHeader: "query-key"}
+
+	for i := 0; i < 2; i++ {
+		response := serveWithHeaders(server.Router, "/1/queries/count/2015", headers)
+		assert.Equal(t, http.StatusOK, response.Code, "Requests within the burst should be allowed")
+	}
+
+	response := serveWithHeaders(server.Router, "/1/queries/count/2015", headers)
+	assert.Equal(t, http.StatusTooManyRequests, response.Code, "Requests above the rate should be limited")
+	assert.Equal(t, "2", response.Header().Get("Retry-After"), "The time until the next token should be sent, in seconds")
+	assert.Equal(t, CodeRateLimited, apiError(response.Body.Bytes()).Code, "Requests above the rate should be told so")
+
+	server.Reload(withKeys(config.APIKey{Name: "dashboard", Key: "query-key", Role: config.RoleQuery}))
+	response = serveWithHeaders(server.Router, "/1/queries/count/2015", headers)
+	assert.Equal(t, http.StatusOK, response.Code, "Reloading a key without rate should lift the limit")
+}
+
+func apiError(body []byte) APIError {
+	var envelope struct{ Error APIError }
+	json.Unmarshal(body, &envelope)
+	return envelope.Error
+}
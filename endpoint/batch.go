@@ -0,0 +1,141 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/query"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+const (
+	batchURL = v1queries + "/batch"
+
+	// The number of sub-queries a batch holds at most
+	maxBatchSize = 100
+
+	// Types of the sub-queries of a batch
+	countSubQuery     = "count"
+	popularSubQuery   = "popular"
+	histogramSubQuery = "histogram"
+
+	// Parameters of the sub-queries, besides datePrefix and size
+	typeParam     = "type"
+	intervalParam = "interval"
+)
+
+// BatchRequest : the sub-queries of a batch
+type BatchRequest struct {
+	Queries []SubQuery `json:"queries"`
+}
+
+// SubQuery : a query of a batch. Size only applies to popular sub-queries, and Interval to histogram ones (month, day, hour or minute).
+// ID is echoed back in the result, to tell results apart.
+type SubQuery struct {
+	ID         string            `json:"id,omitempty"`
+	Type       string            `json:"type"`
+	DatePrefix string            `json:"datePrefix"`
+	Size       *int              `json:"size,omitempty"`
+	Interval   string            `json:"interval,omitempty"`
+	Filters    map[string]string `json:"filters,omitempty"`
+}
+
+// SubResult : the result of a sub-query. Only the fields of its type are set, or Error when it failed.
+type SubResult struct {
+	ID      string               `json:"id,omitempty"`
+	Type    string               `json:"type"`
+	Count   *int                 `json:"count,omitempty"`
+	Queries *[]query.QueryResult `json:"queries,omitempty"`
+	Size    *int                 `json:"size,omitempty"`
+	Clamped *bool                `json:"clamped,omitempty"`
+	Buckets *[]query.Bucket      `json:"buckets,omitempty"`
+	Error   *APIError            `json:"error,omitempty"`
+}
+
+// BatchResult : the results of a batch, in the order of its sub-queries
+type BatchResult struct {
+	Results []SubResult `json:"results"`
+}
+
+// batch : evaluates every sub-query against the same index, even when re-indexing swaps it or ingestion adds to it meanwhile.
+// A failed sub-query does not fail the batch : its result holds the error instead. The body is validated beforehand, see validateBody.
+func batch(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var request BatchRequest
+		decoder := json.NewDecoder(context.Request.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			abort(context, &APIError{Code: CodeInvalidBody, Message: "Could not read batch : " + err.Error(), status: http.StatusBadRequest})
+			return
+		}
+
+		defaultSize, maxSize := server.config().Sizes()
+		results := make([]SubResult, 0, len(request.Queries))
+
+		server.live.RLock()
+		for _, subQuery := range request.Queries {
+			result, err := server.evaluate(server.live.index, subQuery, defaultSize, maxSize)
+			if err != nil {
+				result = SubResult{Error: AsAPIError(err)}
+			}
+			result.ID, result.Type = subQuery.ID, subQuery.Type
+
+			results = append(results, result)
+		}
+		server.live.RUnlock()
+
+		context.JSON(http.StatusOK, BatchResult{results})
+	}
+}
+
+// evaluate : runs a sub-query, the same way its endpoint would
+func (server *Server) evaluate(live *index.Index, subQuery SubQuery, defaultSize, maxSize int) (SubResult, error) {
+	keyType, err := util.IdentifyKey(subQuery.DatePrefix)
+	if err != nil {
+		return SubResult{}, err
+	}
+
+	filteredIndex, err := live.Filter(subQuery.Filters)
+	if err != nil {
+		return SubResult{}, err
+	}
+
+	start := time.Now()
+	switch subQuery.Type {
+	case countSubQuery:
+		count, err := query.CountURLs(filteredIndex, subQuery.DatePrefix, keyType)
+		server.metrics.ObserveQuery(subQuery.Type, keyType.String(), time.Since(start))
+		return SubResult{Count: &count}, err
+
+	case popularSubQuery:
+		size := ""
+		if subQuery.Size != nil {
+			size = strconv.Itoa(*subQuery.Size)
+		}
+
+		n, clamped, err := CheckSize(size, defaultSize, maxSize)
+		if err != nil {
+			return SubResult{}, err
+		}
+
+		queries, err := server.topQueries(filteredIndex, subQuery.Filters, subQuery.DatePrefix, keyType, n)
+		return SubResult{Queries: &queries, Size: &n, Clamped: &clamped}, err
+
+	case histogramSubQuery:
+		interval, err := util.ParseKeyType(subQuery.Interval)
+		if err != nil {
+			return SubResult{}, &APIError{Code: CodeInvalidParameter, Message: err.Error(), Field: intervalParam, status: http.StatusBadRequest}
+		}
+
+		buckets, err := query.Histogram(filteredIndex, subQuery.DatePrefix, keyType, interval)
+		server.metrics.ObserveQuery(subQuery.Type, keyType.String(), time.Since(start))
+		return SubResult{Buckets: &buckets}, err
+	}
+
+	return SubResult{}, &APIError{Code: CodeInvalidParameter, Message: "Unknown query type : " + subQuery.Type, Field: typeParam,
+		Details: gin.H{"enum": []string{countSubQuery, popularSubQuery, histogramSubQuery}}, status: http.StatusBadRequest}
+}
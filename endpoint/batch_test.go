@@ -0,0 +1,84 @@
+package endpoint
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/parser"
+)
+
+func batchRouter() *Server {
+	index := index.EmptyIndex()
+	for _, line := range []string{constant.CorrectLine, constant.CorrectLine, constant.DateAsString + constant.Tab + "http://other-url"} {
+		parsedQuery, _ := parser.ParseHNQuery(line)
+		index.Add(parsedQuery)
+	}
+
+	return NewServer(index, &config.Config{DefaultSize: 1, MaxSize: 10})
+}
+
+func Test_Router_Batch_ShouldRunEverySubQuery(t *testing.T) {
+	router := batchRouter().Router
+	response := post(router, "/1/queries/batch", "application/json", `{"queries": [
+		{"id": "total", "type": "count", "datePrefix": "2015"},
+		{"type": "popular", "datePrefix": "2015-08"},
+		{"type": "popular", "datePrefix": "2016", "size": 20},
+		{"type": "histogram", "datePrefix": "2015-08-01", "interval": "hour"}
+	]}`)
+
+	assert.Equal(t, http.StatusOK, response.Code, "The batch should have been run")
+	assert.JSONEq(t, `{"results": [
+		{"id": "total", "type": "count", "count": 2},
+		{"type": "popular", "queries": [{"query": "`+constant.URLAsString+`", "count": 2}], "size": 1, "clamped": false},
+		{"type": "popular", "queries": [], "size": 10, "clamped": true},
+		{"type": "histogram", "buckets": [{"start": "2015-08-01T00:00:00Z", "count": 2, "total": 3}]}
+	]}`, response.Body.String(), "Every sub-query should have a result, in order")
+}
+
+func Test_Router_Batch_FailedSubQuery_ShouldNotFailBatch(t *testing.T) {
+	router := batchRouter().Router
+	response := post(router, "/1/queries/batch", "application/json", `{"queries": [
+		{"type": "count", "datePrefix": "2015-8"},
+		{"type": "popular", "datePrefix": "2015", "size": 0},
+		{"type": "histogram", "datePrefix": "2015", "interval": "year"},
+		{"type": "sum", "datePrefix": "2015"},
+		{"type": "count", "datePrefix": "2015", "filters": {"country": "FR", "user": "alice"}},
+		{"type": "count", "datePrefix": "2015"}
+	]}`)
+
+	assert.Equal(t, http.StatusOK, response.Code, "The batch should have been run")
+	assert.JSONEq(t, `{"results": [
+		{"type": "count", "error": {"code": "invalid_parameter", "message": "Could not identify key type from : 2015-8", "field": "datePrefix"}},
+		{"type": "popular", "error": {"code": "invalid_parameter", "message": "Wrong size parameter : 0 is not a positive number", "field": "size", "details": {"minimum": 1}}},
+		{"type": "histogram", "error": {"code": "invalid_parameter", "message": "Could not split a year by year : the interval should be finer, and at least a minute", "field": "interval"}},
+		{"type": "sum", "error": {"code": "invalid_parameter", "message": "Unknown query type : sum", "field": "type", "details": {"enum": ["count", "popular", "histogram"]}}},
+		{"type": "count", "error": {"code": "invalid_filter", "message": "Only one filter can be applied at once"}},
+		{"type": "count", "count": 2}
+	]}`, response.Body.String(), "Failed sub-queries should hold their error")
+}
+
+func Test_Router_Batch_InvalidBatch_ShouldBeRejected(t *testing.T) {
+	router := batchRouter().Router
+
+	tooMany := make([]string, maxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = `{"type": "count", "datePrefix": "` + strconv.Itoa(2000+i) + `"}`
+	}
+
+	for _, body := range []string{
+		`not json`,
+		`{"queries": []}`,
+		`{"queries": [{"type": "count", "datePrefix": "2015", "unknown": 1}]}`,
+		`{"queries": [` + strings.Join(tooMany, ",") + `]}`,
+	} {
+		response := post(router, "/1/queries/batch", "application/json", body)
+		assert.Equal(t, http.StatusBadRequest, response.Code, "An invalid batch should be rejected")
+		assert.Contains(t, response.Body.String(), CodeInvalidBody, "An invalid batch should be an invalid body")
+	}
+}
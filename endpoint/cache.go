@@ -0,0 +1,104 @@
+package endpoint
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/query"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+// Answers of the query endpoints only change when the index does : they can be stored, as long as they are revalidated with their ETag
+const cacheControl = "no-cache"
+
+// popularKey : what the answer of a popular query depends on
+type popularKey struct {
+	query      string
+	datePrefix string
+	filter     string
+	size       int
+	version    uint64
+}
+
+// topQueries : see query.FindTopNQueries. Answers are cached until the index changes.
+func (server *Server) topQueries(filteredIndex *index.Index, filters map[string]string, datePrefix string, keyType util.KeyType, n int) ([]query.QueryResult, error) {
+	key := popularKey{"popular", datePrefix, filterKey(filters), n, filteredIndex.Version}
+	if cached, found := server.popular.Get(key); found {
+		server.metrics.ObserveCache(true)
+		return cached.([]query.QueryResult), nil
+	}
+	server.metrics.ObserveCache(false)
+
+	start := time.Now()
+	topQueries, err := query.FindTopNQueries(filteredIndex, datePrefix, keyType, n)
+	server.metrics.ObserveQuery("popular", keyType.String(), time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	server.popular.Add(key, topQueries)
+	return topQueries, nil
+}
+
+// filterKey : the filters as a string, the same whatever the order they were given in
+func filterKey(filters map[string]string) string {
+	values := url.Values{}
+	for name, value := range filters {
+		values.Set(name, value)
+	}
+
+	return values.Encode()
+}
+
+// notModified : sets the ETag and Cache-Control headers of an answer computed from the given version of the index,
+// then answers 304 when the request already holds it (If-None-Match). Handlers must return right away when it does.
+// settings are what the answer depends on besides the request and the index (e.g. the sizes configured).
+func (server *Server) notModified(context *gin.Context, version uint64, settings ...string) bool {
+	serializer, err := Negotiate(context.Query(formatParam), context.GetHeader("Accept"))
+	if err != nil {
+		return false
+	}
+
+	tag := etag(server.epoch, version, serializer, settings)
+	context.Header("ETag", tag)
+	context.Header("Cache-Control", cacheControl)
+	vary(context, "Accept")
+
+	if !matches(context.GetHeader("If-None-Match"), tag) {
+		return false
+	}
+
+	context.Status(http.StatusNotModified)
+	return true
+}
+
+// etag : tells answers apart by the epoch of the server, the version of the index, the settings and the format,
+// e.g. "9f86d081884c7d65-42-10-false-json". Versions start over with every process : the epoch keeps a tag held
+// from before a restart from matching another answer.
+func etag(epoch string, version uint64, serializer Serializer, settings []string) string {
+	parts := append([]string{epoch, strconv.FormatUint(version, 10)}, settings...)
+	for _, name := range FormatNames {
+		if Serializers[name] == serializer {
+			parts = append(parts, name)
+		}
+	}
+
+	return `"` + strings.Join(parts, "-") + `"`
+}
+
+// matches : whether an If-None-Match header holds the ETag. Weak ETags match their strong counterpart.
+func matches(ifNoneMatch, tag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+package endpoint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+func serveWithHeaders(router *gin.Engine, target string, headers map[string]string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_Router_ShouldAnswerNotModifiedUntilIndexChanges(t *testing.T) {
+	parsedQuery, _ := parser.ParseHNQuery(constant.CorrectLine)
+	index := index.EmptyIndex()
+	index.Add(parsedQuery)
+	router := Router(index, ingestConfig())
+
+	for _, target := range []string{"/1/queries/count/2015", "/1/queries/popular/2015?size=5"} {
+		response := serve(router, http.MethodGet, target)
+		etag := response.Header().Get("ETag")
+		assert.NotEmpty(t, etag, "An answer should have an ETag : "+target)
+		assert.Equal(t, cacheControl, response.Header().Get("Cache-Control"), "An answer should be revalidated : "+target)
+
+		response = serveWithHeaders(router, target, map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, response.Code, "An answer already held should not be sent again : "+target)
+		assert.Empty(t, response.Body.String(), "A 304 should have no body : "+target)
+
+		response = serveWithHeaders(router, target, map[string]string{"If-None-Match": `"other", W/` + etag})
+		assert.Equal(t, http.StatusNotModified, response.Code, "Any ETag of the list, weak or not, should match : "+target)
+
+		response = serveWithHeaders(router, target, map[string]string{"If-None-Match": etag, "Accept": csvContentType})
+		assert.Equal(t, http.StatusOK, response.Code, "Another format should not match : "+target)
+
+		post(router, "/1/ingest", "text/plain", constant.CorrectLine)
+		response = serveWithHeaders(router, target, map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusOK, response.Code, "A change of the index should send the answer again : "+target)
+		assert.NotEqual(t, etag, response.Header().Get("ETag"), "A change of the index should change the ETag : "+target)
+	}
+}
+
+func Test_Router_ShouldNotShareETagsAcrossServers(t *testing.T) {
+	parsedQuery, _ := parser.ParseHNQuery(constant.CorrectLine)
+	index := index.EmptyIndex()
+	index.Add(parsedQuery)
+
+	// Two servers of the same index stand for one process before and after a restart, as versions start over with every process
+	before, after := Router(index, config.Default()), Router(index, config.Default())
+	for _, target := range []string{"/1/queries/count/2015", "/1/queries/popular/2015?size=5"} {
+		etag := serve(before, http.MethodGet, target).Header().Get("ETag")
+		assert.NotEqual(t, etag, serve(after, http.MethodGet, target).Header().Get("ETag"), "Two servers should not send the same ETag : "+target)
+
+		response := serveWithHeaders(after, target, map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusOK, response.Code, "An ETag of another server should not match : "+target)
+	}
+}
+
+func Test_Router_Error_ShouldNotHaveETag(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	response := serve(router, http.MethodGet, "/1/queries/popular/2015-13")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "An invalid month should be rejected")
+	assert.Empty(t, response.Header().Get("ETag"), "An error should have no ETag")
+	assert.Empty(t, response.Header().Get("Cache-Control"), "An error should not be cached")
+}
+
+func Test_TopQueries_ShouldBeCachedUntilIndexChanges(t *testing.T) {
+	parsedQuery, _ := parser.ParseHNQuery(constant.CorrectLine)
+	index := index.EmptyIndex()
+	index.Add(parsedQuery)
+	server := NewServer(index, config.Default())
+
+	first, _ := server.topQueries(index, nil, "2015", util.Year, 5)
+	second, _ := server.topQueries(index, map[string]string{}, "2015", util.Year, 5)
+	assert.Equal(t, first, second, "The cached answer should be the one computed")
+	assert.Equal(t, 1, server.popular.Len(), "The same query should be cached once")
+
+	server.topQueries(index, nil, "2015", util.Year, 1)
+	assert.Equal(t, 2, server.popular.Len(), "Another size should be cached apart")
+
+	index.Add(parsedQuery)
+	third, _ := server.topQueries(index, nil, "2015", util.Year, 5)
+	assert.Equal(t, 2, third[0].Count, "A change of the index should not answer from the cache")
+}
+
+func Test_TopQueries_Error_ShouldNotBeCached(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), config.Default())
+
+	_, err := server.topQueries(server.live.index, nil, "2015-13", util.Month, 5)
+	assert.Error(t, err, "An invalid month should fail")
+	assert.Equal(t, 0, server.popular.Len(), "An error should not be cached")
+}
@@ -1,16 +1,27 @@
 package endpoint
 
 import (
-	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/thomaspepio/hn-queries/query"
 
 	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/cache"
+	"github.com/thomaspepio/hn-queries/config"
 	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/ingestion"
+	"github.com/thomaspepio/hn-queries/logging"
+	"github.com/thomaspepio/hn-queries/metrics"
+	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/ratelimit"
 	"github.com/thomaspepio/hn-queries/util"
 )
 
@@ -23,75 +34,304 @@ const (
 	// The size query parameter
 	sizeParam = "size"
 
+	// The prefix of the query parameters filtering on an attribute, e.g. filter.country=FR
+	filterPrefix = "filter."
+
 	// URLs we support
 	countQueriesURL   = v1queries + "/count/:" + datePrefixParam
 	popularQueriesURL = v1queries + "/popular/:" + datePrefixParam
+	ingestURL         = "/1/ingest"
+	reindexURL        = "/1/admin/reindex"
 )
 
+// liveIndex : the index the endpoints serve. Queries read it while ingestion adds to it,
+// and re-indexing swaps it for a fresh one.
+// While re-indexing runs, ingested keeps the queries added to the index, so that they are added to the fresh one as well.
+type liveIndex struct {
+	sync.RWMutex
+	index    *index.Index
+	ingested []*parser.ParsedQuery
+}
+
+// swap : replaces the index, once every query reading the former one is done
+func (live *liveIndex) swap(index *index.Index) {
+	live.Lock()
+	live.index = index
+	live.Unlock()
+}
+
+// add : adds the queries to the index, and returns how many could be added
+func (live *liveIndex) add(parsedQueries []*parser.ParsedQuery) int {
+	live.Lock()
+	defer live.Unlock()
+
+	added := 0
+	for _, parsedQuery := range parsedQueries {
+		if addError := live.index.Add(parsedQuery); addError == nil {
+			added++
+			if live.ingested != nil {
+				live.ingested = append(live.ingested, parsedQuery)
+			}
+		}
+	}
+
+	return added
+}
+
+// keepIngested : keeps the queries added from now on, until swapKeeping or dropIngested is called
+func (live *liveIndex) keepIngested() {
+	live.Lock()
+	live.ingested = []*parser.ParsedQuery{}
+	live.Unlock()
+}
+
+// dropIngested : stops keeping the queries added, e.g. when re-indexing failed
+func (live *liveIndex) dropIngested() {
+	live.Lock()
+	live.ingested = nil
+	live.Unlock()
+}
+
+// swapKeeping : replaces the index as swap does, once the queries kept since keepIngested are added to the fresh one.
+// Queries are not served meanwhile, nor ingested : no query is lost, nor added twice.
+func (live *liveIndex) swapKeeping(index *index.Index) {
+	live.Lock()
+	defer live.Unlock()
+
+	for _, parsedQuery := range live.ingested {
+		index.Add(parsedQuery)
+	}
+	live.index = index
+	live.ingested = nil
+}
+
+// read : the index, read-locked until the returned function is called
+func (live *liveIndex) read() (*index.Index, func()) {
+	live.RLock()
+	return live.index, live.RUnlock
+}
+
+// Server : the endpoints of the application, along with the index and the configuration they share
+type Server struct {
+	Router        *gin.Engine
+	live          *liveIndex
+	configuration atomic.Value
+	startup       *ingestion.Progress
+	metrics       *metrics.Metrics
+	popular       *cache.LRU
+	limiter       *ratelimit.Limiter
+	logger        *logging.Logger
+	epoch         string
+	liveRefresh   time.Duration
+	streamsClosed chan struct{}
+	closeStreams  sync.Once
+}
+
 // Router : return the endpoints of the application
-func Router(index *index.Index) *gin.Engine {
-	router := gin.Default()
+func Router(index *index.Index, configuration *config.Config) *gin.Engine {
+	return NewServer(index, configuration).Router
+}
 
-	router.GET(countQueriesURL, func(context *gin.Context) {
-		datePrefix := context.Param(datePrefixParam)
+// Reload : applies a new configuration to the endpoints (sources to re-index from, admin token, sizes).
+// The cache keeps the size it was created with.
+func (server *Server) Reload(configuration *config.Config) {
+	server.configuration.Store(configuration)
+}
+
+// Ready : starts serving queries from an index, once a server created by NewStartingServer loaded it
+func (server *Server) Ready(index *index.Index) {
+	server.live.swap(index)
+}
+
+// WriteSnapshot : writes the index currently served, see index.WriteSnapshot
+func (server *Server) WriteSnapshot(writer io.Writer) error {
+	server.live.RLock()
+	defer server.live.RUnlock()
+
+	if server.live.index == nil {
+		return errors.New("Could not write snapshot : the index is still loading")
+	}
+
+	return server.live.index.WriteSnapshot(writer)
+}
+
+// Index : the index currently served, read-locked until the returned function is called. It is nil while the index is loading.
+func (server *Server) Index() (*index.Index, func()) {
+	return server.live.read()
+}
+
+// Sizes : the default and maximum sizes of the popular endpoint, see config.Config.Sizes
+func (server *Server) Sizes() (int, int) {
+	return server.config().Sizes()
+}
+
+// Configuration : the configuration currently applied, along with its API keys
+func (server *Server) Configuration() *config.Config {
+	return server.config()
+}
+
+// Limiter : the rate limiter of the API keys, so that other services limit a key to the same rate as the endpoints
+func (server *Server) Limiter() *ratelimit.Limiter {
+	return server.limiter
+}
+
+func (server *Server) config() *config.Config {
+	return server.configuration.Load().(*config.Config)
+}
 
+// log : the logger of the requests. Unless one was given, it follows the logger of the process, which is set up again on SIGHUP.
+func (server *Server) log() *logging.Logger {
+	if server.logger != nil {
+		return server.logger
+	}
+
+	return logging.Component("http")
+}
+
+// NewServer : sets up the endpoints of the application
+func NewServer(index *index.Index, configuration *config.Config) *Server {
+	return newServer(index, configuration, nil)
+}
+
+// NewStartingServer : sets up the endpoints of the application while its index is loading.
+// Until Ready is called, /readyz reports the loading progress and every other endpoint but /healthz answers 503.
+// progress can be nil when the loading cannot report it (e.g. when reading a snapshot).
+func NewStartingServer(configuration *config.Config, progress *ingestion.Progress) *Server {
+	return newServer(nil, configuration, progress)
+}
+
+func newServer(index *index.Index, configuration *config.Config, startup *ingestion.Progress) *Server {
+	router := gin.New()
+	live := &liveIndex{index: index}
+	server := &Server{Router: router, live: live, startup: startup, metrics: metrics.New(), popular: cache.New(configuration.CacheSize),
+		limiter: ratelimit.NewLimiter(), epoch: randomID(), liveRefresh: defaultLiveRefresh, streamsClosed: make(chan struct{})}
+	server.Reload(configuration)
+
+	if startup != nil {
+		startup.Observe(server.metrics.ObserveLine)
+	}
+	server.metrics.WatchIndex(live.read)
+
+	router.Use(server.middlewares()...)
+	router.NoRoute(notFound)
+	router.GET(metricsURL, gin.WrapH(server.metrics.Handler()))
+	router.GET(healthURL, health)
+	router.GET(readinessURL, readiness(server))
+
+	specification := Specification()
+	router.GET(openAPIURL, openAPI(specification))
+
+	ready := router.Group("", authenticate(server, config.RoleQuery), readyOnly(server))
+	ready.GET(countQueriesURL, validate(specification.Operation(http.MethodGet, countQueriesURL)), func(context *gin.Context) {
+		live.RLock()
+		defer live.RUnlock()
+
+		datePrefix := context.Param(datePrefixParam)
 		keyType, keyTypeError := util.IdentifyKey(datePrefix)
 		if keyTypeError != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect datePrefix parameter. " + keyTypeError.Error()})
-		} else {
-			count, countError := query.CountURLs(index, datePrefix, keyType)
-			if countError != nil {
-				context.JSON(http.StatusInternalServerError, gin.H{"error": "Error while computing URL count. " + countError.Error()})
-			} else {
-				context.JSON(http.StatusOK, gin.H{"count": count})
-			}
+			abort(context, keyTypeError)
+			return
+		}
+
+		filteredIndex, filterError := live.index.Filter(Filters(context.Request.URL.Query()))
+		if filterError != nil {
+			abort(context, filterError)
+			return
+		}
+
+		if server.notModified(context, filteredIndex.Version) {
+			return
+		}
+
+		start := time.Now()
+		count, countError := query.CountURLs(filteredIndex, datePrefix, keyType)
+		server.metrics.ObserveQuery("count", keyType.String(), time.Since(start))
+		if countError != nil {
+			abort(context, countError)
+			return
 		}
+
+		respond(context, CountResult(count))
 	})
 
-	router.GET(popularQueriesURL, func(context *gin.Context) {
-		datePrefix := context.Param(datePrefixParam)
-		size := context.Query(sizeParam)
+	ready.GET(popularQueriesURL, orLive(server), validate(specification.Operation(http.MethodGet, popularQueriesURL)), func(context *gin.Context) {
+		live.RLock()
+		defer live.RUnlock()
 
-		keyType, datePrefixTypeError := util.IdentifyKey(datePrefix)
-		if datePrefixTypeError != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": datePrefixTypeError.Error()})
+		datePrefix := context.Param(datePrefixParam)
+		keyType, keyTypeError := util.IdentifyKey(datePrefix)
+		if keyTypeError != nil {
+			abort(context, keyTypeError)
+			return
 		}
 
-		n, sizeError := CheckSize(size)
+		defaultSize, maxSize := server.config().Sizes()
+		n, clamped, sizeError := CheckSize(context.Query(sizeParam), defaultSize, maxSize)
 		if sizeError != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": sizeError.Error()})
-		} else {
-			topQueries, topQueriesError := query.FindTopNQueries(index, datePrefix, keyType, n)
-			if topQueriesError != nil {
-				context.JSON(http.StatusInternalServerError, gin.H{"error": "Error while computing top queries. " + topQueriesError.Error()})
-			} else {
-				context.JSON(http.StatusOK, gin.H{"queries": topQueries})
-			}
+			abort(context, sizeError)
+			return
 		}
+		context.Set(sizeParam, n)
+
+		filters := Filters(context.Request.URL.Query())
+		filteredIndex, filterError := live.index.Filter(filters)
+		if filterError != nil {
+			abort(context, filterError)
+			return
+		}
+
+		if server.notModified(context, filteredIndex.Version, strconv.Itoa(n), strconv.FormatBool(clamped)) {
+			return
+		}
+
+		topQueries, topQueriesError := server.topQueries(filteredIndex, filters, datePrefix, keyType, n)
+		if topQueriesError != nil {
+			abort(context, topQueriesError)
+			return
+		}
+
+		respond(context, PopularResult(topQueries, n, clamped))
 	})
 
-	return router
+	ready.POST(batchURL, validateBody(specification, specification.Operation(http.MethodPost, batchURL)), batch(server))
+
+	reindexer := &reindexer{}
+	router.POST(ingestURL, ingestOnly(server), readyOnly(server), ingest(server))
+	admin := router.Group("", adminOnly(server), readyOnly(server))
+	admin.POST(reindexURL, reindexer.start(server))
+	admin.GET(reindexURL, reindexer.status)
+
+	return server
 }
 
-// CheckSize : checks the validity of the size query paramter
-func CheckSize(size string) (int, error) {
+// CheckSize : checks the validity of the size query paramter, which must be a positive number.
+// A missing size is defaultSize, and a size greater than maxSize is clamped to it, clamped telling so.
+func CheckSize(size string, defaultSize, maxSize int) (n int, clamped bool, err error) {
+	if size == "" {
+		return defaultSize, false, nil
+	}
+
 	n, convError := strconv.Atoi(size)
-	if convError != nil {
-		return -1, errors.New("Wrong size parameter : " + size)
+	if convError != nil || n < 1 {
+		return -1, false, &SizeError{size}
 	}
 
-	return n, nil
-}
+	if n > maxSize {
+		return maxSize, true, nil
+	}
 
-// QueryResult: converts a query.QueryResult to a JSON string
-func QueryResultToJson(query query.QueryResult) (string, error) {
-	byteArray, err := json.Marshal(query)
+	return n, false, nil
+}
 
-	if err != nil {
-		return "error", err
+// Filters : extracts the attribute filters from the query parameters prefixed with filter. (e.g. ?filter.country=FR).
+// Any other parameter is not a filter, and is left to the endpoint. When a parameter is repeated, only its first value is used.
+func Filters(parameters url.Values) map[string]string {
+	filters := make(map[string]string)
+	for name, values := range parameters {
+		if dimension := strings.TrimPrefix(name, filterPrefix); dimension != name && dimension != "" && len(values) > 0 {
+			filters[dimension] = values[0]
+		}
 	}
 
-	queryQuotesRemoved := strings.Replace(string(byteArray), "\"query\"", "query", 1)
-	countQuotesRemoved := strings.Replace(queryQuotesRemoved, "\"count\"", "count", 1)
-	return countQuotesRemoved, nil
+	return filters
 }
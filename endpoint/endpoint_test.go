@@ -1,28 +1,122 @@
 package endpoint
 
 import (
+	"encoding/json"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/parser"
 	"github.com/thomaspepio/hn-queries/query"
 )
 
-func Test_Size_AnyNumber_ShouldBeAccepted(t *testing.T) {
-	size := rand.Intn(100)
-	n, err := CheckSize(strconv.Itoa(size))
-	assert.NotNil(t, n, "Any number is an acceptable size parameter")
-	assert.Nil(t, err, "Any number is an acceptable size parameter")
+func init() {
+	gin.SetMode(gin.TestMode)
 }
 
-func Test_Size_OtherThanNumber_ShouldNotBeAccepted(t *testing.T) {
-	_, err := CheckSize("foo")
-	assert.Error(t, err, "Anything that is not a number is not a valid size parameter")
+func serve(router *gin.Engine, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
 }
 
-func Test_TopQueryResult_ToJSON(t *testing.T) {
-	queryResult := query.QueryResult{"foo", 1}
-	asJson, _ := QueryResultToJson(queryResult)
-	assert.Equal(t, "{query:\"foo\",count:1}", asJson, "QueryResult not JSON encoded properly")
+func Test_Size_AnyPositiveNumber_ShouldBeAccepted(t *testing.T) {
+	size := rand.Intn(100) + 1
+	n, clamped, err := CheckSize(strconv.Itoa(size), 10, 100)
+	assert.Equal(t, size, n, "Any positive number is an acceptable size parameter")
+	assert.False(t, clamped, "A size lower than the maximum should not be clamped")
+	assert.Nil(t, err, "Any positive number is an acceptable size parameter")
+}
+
+func Test_Size_OtherThanPositiveNumber_ShouldNotBeAccepted(t *testing.T) {
+	for _, size := range []string{"foo", "0", "-1"} {
+		_, _, err := CheckSize(size, 10, 100)
+		assert.Error(t, err, "Anything that is not a positive number is not a valid size parameter : "+size)
+	}
+}
+
+func Test_Size_Missing_ShouldBeDefaultSize(t *testing.T) {
+	n, clamped, err := CheckSize("", 10, 100)
+	assert.Equal(t, 10, n, "A missing size should be the default size")
+	assert.False(t, clamped, "The default size should not be clamped")
+	assert.Nil(t, err, "A missing size is an acceptable size parameter")
+}
+
+func Test_Size_AboveMaximum_ShouldBeClamped(t *testing.T) {
+	n, clamped, err := CheckSize("1000", 10, 100)
+	assert.Equal(t, 100, n, "A size above the maximum should be clamped to it")
+	assert.True(t, clamped, "A size above the maximum should be reported as clamped")
+	assert.Nil(t, err, "A size above the maximum is an acceptable size parameter")
+}
+
+func Test_Router_Popular_ShouldApplySizeSettings(t *testing.T) {
+	index := index.EmptyIndex()
+	for i := 0; i < 3; i++ {
+		parsedQuery, _ := parser.ParseHNQuery(constant.DateAsString + constant.Tab + "http://url-" + strconv.Itoa(i))
+		index.Add(parsedQuery)
+	}
+	router := Router(index, &config.Config{DefaultSize: 1, MaxSize: 2})
+
+	var body struct {
+		Queries []query.QueryResult
+		Size    int
+		Clamped bool
+	}
+	response := serve(router, http.MethodGet, "/1/queries/popular/2015")
+	json.Unmarshal(response.Body.Bytes(), &body)
+	assert.Equal(t, 1, len(body.Queries), "The default size should apply when no size is asked for")
+	assert.False(t, body.Clamped, "The default size should not be clamped")
+
+	response = serve(router, http.MethodGet, "/1/queries/popular/2015?size=3")
+	json.Unmarshal(response.Body.Bytes(), &body)
+	assert.Equal(t, 2, len(body.Queries), "The size should be clamped to the maximum")
+	assert.Equal(t, 2, body.Size, "The clamped size should be reported")
+	assert.True(t, body.Clamped, "The size should be reported as clamped")
+
+	response = serve(router, http.MethodGet, "/1/queries/popular/2015?size=0")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "A size of 0 should be rejected")
+}
+
+func Test_Filters_ShouldOnlyReadPrefixedParameters(t *testing.T) {
+	filters := Filters(url.Values{"size": {"10"}, "format": {"csv"}, "_": {"123"}, "window": {""}, "filter.": {"x"}, "filter.country": {"FR", "US"}})
+	assert.Equal(t, map[string]string{"country": "FR"}, filters, "Only the parameters prefixed with filter. should be filters")
+}
+
+func Test_Router_ShouldFilterOnAttributes(t *testing.T) {
+	index := index.EmptyIndex()
+	for line, country := range map[string]string{
+		constant.CorrectLine: "FR",
+		constant.DateAsString + constant.Tab + "http://other-url": "US",
+	} {
+		parsedQuery, _ := parser.ParseHNQuery(line)
+		parsedQuery.Attributes = map[string]string{"country": country}
+		index.Add(parsedQuery)
+	}
+	router := Router(index, config.Default())
+
+	response := serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.JSONEq(t, `{"count": 2}`, response.Body.String(), "Both queries should be counted without filter")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015?filter.country=FR")
+	assert.JSONEq(t, `{"count": 1}`, response.Body.String(), "Only the query from France should be counted")
+
+	response = serve(router, http.MethodGet, "/1/queries/popular/2015?size=5&filter.country=US")
+	assert.JSONEq(t, `{"queries": [{"query": "http://other-url", "count": 1}], "size": 5, "clamped": false}`, response.Body.String(), "Only the query from the US should be popular")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015?filter.browser=firefox")
+	assert.JSONEq(t, `{"count": 0}`, response.Body.String(), "No query should be counted for a dimension never seen")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015?_=123&country=FR")
+	assert.JSONEq(t, `{"count": 2}`, response.Body.String(), "Parameters not prefixed with filter. should be ignored")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015?filter.country=FR&filter.browser=firefox")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "Filtering on two dimensions should be rejected")
 }
@@ -0,0 +1,100 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/query"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+// Machine-readable codes of the errors the API answers with
+const (
+	CodeMissingParameter = "missing_parameter"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidFilter    = "invalid_filter"
+	CodeInvalidBody      = "invalid_body"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeAdminDisabled    = "admin_disabled"
+	CodeIngestDisabled   = "ingest_disabled"
+	CodeNotFound         = "not_found"
+	CodeNotAcceptable    = "not_acceptable"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeNotReady         = "not_ready"
+	CodeTimeout          = "timeout"
+	CodeInternal         = "internal_error"
+)
+
+// APIError : the error every endpoint answers with, as {"error": {...}}.
+// Field names the parameter at fault, if any. Details carries whatever helps fixing the request (e.g. the expected pattern).
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Field   string      `json:"field,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+	status  int
+}
+
+func (err *APIError) Error() string {
+	return err.Message
+}
+
+// Status : the HTTP status of the error
+func (err *APIError) Status() int {
+	return err.status
+}
+
+// SizeError : a size query parameter that is not a positive number
+type SizeError struct {
+	Size string
+}
+
+func (err *SizeError) Error() string {
+	return "Wrong size parameter : " + err.Size + " is not a positive number"
+}
+
+// AsAPIError : maps an error to the HTTP status and code the API answers with.
+// Errors the API does not know about are internal errors.
+func AsAPIError(err error) *APIError {
+	var apiError *APIError
+	var keyError *util.KeyError
+	var datePrefixError *query.DatePrefixError
+	var sizeError *SizeError
+	var filterError *index.FilterError
+	var intervalError *query.IntervalError
+
+	switch {
+	case errors.As(err, &apiError):
+		return apiError
+	case errors.As(err, &keyError):
+		return &APIError{Code: CodeInvalidParameter, Message: keyError.Error(), Field: datePrefixParam, status: http.StatusBadRequest}
+	case errors.As(err, &datePrefixError):
+		return &APIError{Code: CodeInvalidParameter, Message: datePrefixError.Error(), Field: datePrefixParam, status: http.StatusBadRequest}
+	case errors.As(err, &sizeError):
+		return &APIError{Code: CodeInvalidParameter, Message: sizeError.Error(), Field: sizeParam, Details: gin.H{"minimum": 1}, status: http.StatusBadRequest}
+	case errors.As(err, &intervalError):
+		return &APIError{Code: CodeInvalidParameter, Message: intervalError.Error(), Field: intervalParam, status: http.StatusBadRequest}
+	case errors.As(err, &filterError):
+		return &APIError{Code: CodeInvalidFilter, Message: filterError.Error(), Field: filterError.Dimension, status: http.StatusBadRequest}
+	}
+
+	return &APIError{Code: CodeInternal, Message: err.Error(), status: http.StatusInternalServerError}
+}
+
+// abort : answers with the error and stops the handler chain. Handlers must return right after.
+// Errors are never cached : the ETag and Cache-Control headers set meanwhile are dropped.
+func abort(context *gin.Context, err error) {
+	apiError := AsAPIError(err)
+	context.Writer.Header().Del("ETag")
+	context.Writer.Header().Del("Cache-Control")
+	context.AbortWithStatusJSON(apiError.status, gin.H{"error": apiError})
+}
+
+// notFound : the error answered to requests matching no route
+func notFound(context *gin.Context) {
+	abort(context, &APIError{Code: CodeNotFound, Message: "No endpoint at " + context.Request.Method + " " + context.Request.URL.Path, status: http.StatusNotFound})
+}
@@ -0,0 +1,55 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/query"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+func Test_AsAPIError_ShouldMapTypedErrors(t *testing.T) {
+	_, keyError := util.IdentifyKey("foo")
+	_, filterError := index.EmptyIndex().Filter(map[string]string{"country": "FR", "user": "alice"})
+
+	for err, expected := range map[error]APIError{
+		keyError: {Code: CodeInvalidParameter, Field: datePrefixParam, status: http.StatusBadRequest},
+		&query.DatePrefixError{DatePrefix: "2015-13"}: {Code: CodeInvalidParameter, Field: datePrefixParam, status: http.StatusBadRequest},
+		&SizeError{"foo"}:                  {Code: CodeInvalidParameter, Field: sizeParam, status: http.StatusBadRequest},
+		filterError:                        {Code: CodeInvalidFilter, status: http.StatusBadRequest},
+		errors.New("No key was extracted"): {Code: CodeInternal, status: http.StatusInternalServerError},
+	} {
+		apiError := AsAPIError(err)
+		assert.Equal(t, expected.Code, apiError.Code, "Wrong code for : "+err.Error())
+		assert.Equal(t, expected.Field, apiError.Field, "Wrong field for : "+err.Error())
+		assert.Equal(t, expected.status, apiError.Status(), "Wrong status for : "+err.Error())
+		assert.Equal(t, err.Error(), apiError.Message, "The message should be the one of the error")
+	}
+}
+
+func Test_Router_Errors_ShouldShareEnvelope(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	for target, expected := range map[string]string{
+		"/1/queries/count/2015-13": `{"error": {"code": "invalid_parameter", "message": "Could not parse datePrefix : 2015-13", "field": "datePrefix"}}`,
+		"/1/queries/popular/2015?size=1&filter.lang=fr&filter.country=FR": `{"error": {"code": "invalid_filter", "message": "Only one filter can be applied at once"}}`,
+		"/2/queries": `{"error": {"code": "not_found", "message": "No endpoint at GET /2/queries"}}`,
+	} {
+		response := serve(router, http.MethodGet, target)
+		assert.JSONEq(t, expected, response.Body.String(), "Errors should share the same envelope : "+target)
+	}
+}
+
+func Test_Router_Popular_InvalidDatePrefix_ShouldAnswerOnce(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+	response := serve(router, http.MethodGet, "/1/queries/popular/2015-13?size=1")
+
+	var body map[string]interface{}
+	assert.Equal(t, http.StatusBadRequest, response.Code, "An invalid date prefix should be rejected")
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body), "A single JSON document should have been written")
+}
@@ -0,0 +1,78 @@
+package endpoint
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/ingestion"
+)
+
+const (
+	healthURL    = "/healthz"
+	readinessURL = "/readyz"
+)
+
+// Readiness : whether the index can be queried, and how far its loading went when it cannot
+type Readiness struct {
+	Ready      bool              `json:"ready"`
+	Progress   *ingestion.Status `json:"progress,omitempty"`
+	ETA        string            `json:"eta,omitempty"`
+	ETASeconds *float64          `json:"etaSeconds,omitempty"`
+}
+
+// health : the server is alive as soon as it answers
+func health(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readiness : 200 once the index is loaded, 503 along with the loading progress until then
+func readiness(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		readiness := server.readiness(time.Now())
+		if readiness.Ready {
+			context.JSON(http.StatusOK, readiness)
+		} else {
+			context.JSON(http.StatusServiceUnavailable, readiness)
+		}
+	}
+}
+
+// readyOnly : rejects requests with a 503 until the index is loaded
+func readyOnly(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !server.ready() {
+			abort(context, &APIError{Code: CodeNotReady, Message: "The index is still loading, see " + readinessURL, status: http.StatusServiceUnavailable})
+			return
+		}
+
+		context.Next()
+	}
+}
+
+func (server *Server) ready() bool {
+	server.live.RLock()
+	defer server.live.RUnlock()
+
+	return server.live.index != nil
+}
+
+func (server *Server) readiness(now time.Time) Readiness {
+	if server.ready() {
+		return Readiness{Ready: true}
+	}
+
+	readiness := Readiness{Ready: false}
+	if server.startup != nil {
+		status := server.startup.Status()
+		readiness.Progress = &status
+
+		if eta, known := status.ETA(now); known {
+			seconds := eta.Seconds()
+			readiness.ETA = eta.Round(time.Second).String()
+			readiness.ETASeconds = &seconds
+		}
+	}
+
+	return readiness
+}
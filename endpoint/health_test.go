@@ -0,0 +1,56 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/ingestion"
+)
+
+func Test_Health_ShouldAnswerWhileStarting(t *testing.T) {
+	server := NewStartingServer(config.Default(), nil)
+	response := serve(server.Router, http.MethodGet, "/healthz")
+	assert.Equal(t, http.StatusOK, response.Code, "The server should be alive while its index is loading")
+}
+
+func Test_Readiness_ShouldReportProgressWhileStarting(t *testing.T) {
+	server := NewStartingServer(config.Default(), ingestion.NewProgress())
+
+	response := serve(server.Router, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code, "The server should not be ready while its index is loading")
+
+	var readiness Readiness
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &readiness), "Readiness should be JSON")
+	assert.False(t, readiness.Ready, "The server should not be ready while its index is loading")
+	assert.NotNil(t, readiness.Progress, "The loading progress should be reported")
+	assert.Nil(t, readiness.ETASeconds, "No ETA should be reported before any byte was read")
+}
+
+func Test_Readiness_ShouldBeReadyOnceIndexLoaded(t *testing.T) {
+	server := NewStartingServer(config.Default(), ingestion.NewProgress())
+	server.Ready(index.EmptyIndex())
+
+	response := serve(server.Router, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, response.Code, "The server should be ready once its index is loaded")
+	assert.JSONEq(t, `{"ready": true}`, response.Body.String(), "A ready server has no progress to report")
+}
+
+func Test_Queries_ShouldBeUnavailableWhileStarting(t *testing.T) {
+	server := NewStartingServer(ingestConfig(), nil)
+
+	for _, target := range []string{"/1/queries/count/2015", "/1/queries/popular/2015?size=3"} {
+		response := serve(server.Router, http.MethodGet, target)
+		assert.Equal(t, http.StatusServiceUnavailable, response.Code, "Queries should be unavailable while the index is loading : "+target)
+	}
+
+	response := post(server.Router, "/1/ingest", "text/tab-separated-values", "")
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code, "Ingestion should be unavailable while the index is loading")
+
+	server.Ready(index.EmptyIndex())
+	response = serve(server.Router, http.MethodGet, "/1/queries/count/2015")
+	assert.Equal(t, http.StatusOK, response.Code, "Queries should be served once the index is loaded")
+}
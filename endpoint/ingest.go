@@ -0,0 +1,186 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/logging"
+	"github.com/thomaspepio/hn-queries/parser"
+)
+
+const (
+	// Content types of the bodies the ingestion endpoint accepts, TSV being the default
+	ndjsonContentType = "application/x-ndjson"
+	jsonContentType   = "application/json"
+
+	// MaxLineLength : number of bytes a line of an ingestion request can hold, line break excluded. Longer lines are rejected.
+	MaxLineLength = 1 << 20
+
+	// How many rejected lines of an ingestion request are logged one by one, the others being summed up in a single line
+	loggedRejections = 10
+)
+
+// errBodyTooLarge : a body longer than config.Config.MaxIngestBytes
+var errBodyTooLarge = errors.New("Could not read request body : it is longer than the limit")
+
+// IngestResult : the outcome of an ingestion request
+type IngestResult struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []IngestError `json:"errors"`
+}
+
+// IngestError : why a line of an ingestion request was rejected. Lines are numbered from 1.
+type IngestError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// IngestFormat : the format in which the lines of a body are parsed, based on its content type.
+// NDJSON lines are expected to hold "time" and "url" fields, any other body is parsed as HN TSV lines.
+func IngestFormat(contentType string) parser.Format {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == ndjsonContentType || mediaType == jsonContentType {
+		return &parser.JSONLFormat{TimeField: "time", URLField: "url", Layouts: parser.DefaultLayouts}
+	}
+
+	return &parser.TSVFormat{Layouts: parser.DefaultLayouts}
+}
+
+// ParseLines : parses every non empty line of a body, and reports the ones that could not be parsed
+func ParseLines(body io.Reader, format parser.Format) ([]*parser.ParsedQuery, []IngestError, error) {
+	parsedQueries := []*parser.ParsedQuery{}
+	errors := []IngestError{}
+
+	splitter := &lineSplitter{}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineLength+1)
+	scanner.Split(splitter.split)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if splitter.tooLong {
+			errors = append(errors, IngestError{lineNumber, "Line longer than " + strconv.Itoa(MaxLineLength) + " bytes"})
+			continue
+		}
+
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		parsedQuery, parseError := format.Parse(line)
+		if parseError != nil {
+			errors = append(errors, IngestError{lineNumber, parseError.Error()})
+		} else {
+			parsedQueries = append(parsedQueries, parsedQuery)
+		}
+	}
+
+	return parsedQueries, errors, scanner.Err()
+}
+
+// lineSplitter : splits lines as bufio.ScanLines does, except that lines longer than MaxLineLength are skipped
+// instead of failing the scan. tooLong tells whether the last line was skipped, its token then being empty.
+type lineSplitter struct {
+	skipping bool
+	tooLong  bool
+}
+
+func (splitter *lineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	newline := bytes.IndexByte(data, '\n')
+	if newline < 0 && len(data) > MaxLineLength {
+		// The buffer is full : what was read of the line is dropped, until its end is found
+		splitter.skipping = true
+		return len(data), nil, nil
+	}
+
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if token == nil && !(atEOF && splitter.skipping) {
+		return advance, token, err
+	}
+
+	splitter.tooLong = splitter.skipping
+	splitter.skipping = false
+	if splitter.tooLong {
+		return advance, []byte{}, err
+	}
+
+	return advance, token, err
+}
+
+// bodyLimit : a request body failing with errBodyTooLarge once more than limit bytes are read, see http.MaxBytesReader
+type bodyLimit struct {
+	body  io.Reader
+	limit int64
+	read  int64
+}
+
+func (body *bodyLimit) Read(buffer []byte) (int, error) {
+	n, err := body.body.Read(buffer)
+	body.read += int64(n)
+	if body.read > body.limit {
+		return n, errBodyTooLarge
+	}
+
+	return n, err
+}
+
+// ingest : adds the lines of the request body to the live index.
+// Lines are parsed before the index is locked, so that queries are held for as short as possible.
+// Bodies longer than config.Config.MaxIngestBytes are rejected as a whole, and nothing of them is added.
+func ingest(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var body io.Reader = context.Request.Body
+		if limit := server.config().MaxIngestBytes; limit > 0 {
+			body = &bodyLimit{body: body, limit: limit}
+		}
+
+		format := IngestFormat(context.ContentType())
+		parsedQueries, errors, readError := ParseLines(body, format)
+		if readError == errBodyTooLarge {
+			abort(context, &APIError{Code: CodeBodyTooLarge, Message: "Could not read request body : it is longer than " + strconv.FormatInt(server.config().MaxIngestBytes, 10) + " bytes",
+				Details: gin.H{"limit": server.config().MaxIngestBytes}, status: http.StatusRequestEntityTooLarge})
+			return
+		}
+		if readError != nil {
+			abort(context, &APIError{Code: CodeInvalidBody, Message: "Could not read request body. " + readError.Error(), status: http.StatusBadRequest})
+			return
+		}
+
+		// A client gone while the body was parsed gets no answer : it would retry, and the queries would be added twice
+		if context.Request.Context().Err() != nil {
+			return
+		}
+
+		accepted := server.live.add(parsedQueries)
+		server.metrics.ObserveLines(true, accepted)
+		server.metrics.ObserveLines(false, len(errors)+len(parsedQueries)-accepted)
+		server.logRejections(context, errors)
+		context.JSON(http.StatusOK, IngestResult{accepted, len(errors) + len(parsedQueries) - accepted, errors})
+	}
+}
+
+// logRejections : logs the lines of an ingestion request that could not be parsed as warnings, as indexing does.
+// Only the first ones are logged one by one, so that a client sending garbage does not flood the logs.
+func (server *Server) logRejections(context *gin.Context, errors []IngestError) {
+	if len(errors) == 0 {
+		return
+	}
+
+	logger := server.log().With(logging.Fields{"request_id": context.GetString(requestIDKey)})
+	for i, ingestError := range errors {
+		if i == loggedRejections {
+			logger.Warn("More ingested lines could not be parsed", logging.Fields{"rejected": len(errors), "unlogged": len(errors) - loggedRejections})
+			return
+		}
+		logger.Warn("Could not parse ingested line", logging.Fields{"line": ingestError.Line, "error": ingestError.Error})
+	}
+}
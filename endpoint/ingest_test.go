@@ -0,0 +1,139 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/logging"
+	"github.com/thomaspepio/hn-queries/parser"
+)
+
+// The admin token of ingestConfig, which post sends
+const ingestToken = "ingest-secret"
+
+// ingestConfig : the default configuration, along with an admin token opening ingestion
+func ingestConfig() *config.Config {
+	configuration := config.Default()
+	configuration.AdminToken = ingestToken
+	return configuration
+}
+
+func post(router *gin.Engine, target, contentType, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Authorization", "Bearer "+ingestToken)
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_IngestFormat_ShouldDependOnContentType(t *testing.T) {
+	assert.IsType(t, &parser.JSONLFormat{}, IngestFormat("application/x-ndjson"), "NDJSON bodies should be parsed as JSON lines")
+	assert.IsType(t, &parser.JSONLFormat{}, IngestFormat("application/json; charset=utf-8"), "JSON bodies should be parsed as JSON lines")
+	assert.IsType(t, &parser.TSVFormat{}, IngestFormat("text/tab-separated-values"), "TSV bodies should be parsed as HN lines")
+	assert.IsType(t, &parser.TSVFormat{}, IngestFormat(""), "Bodies should be parsed as HN lines by default")
+}
+
+func Test_ParseLines_ShouldReportRejectedLines(t *testing.T) {
+	body := constant.CorrectLine + "\r\n\nnot a line\n" + constant.CorrectLine
+	parsedQueries, errors, err := ParseLines(strings.NewReader(body), IngestFormat(""))
+
+	assert.NoError(t, err, "The body should have been read")
+	assert.Equal(t, 2, len(parsedQueries), "Two lines should have been parsed")
+	assert.Equal(t, []IngestError{{3, "Unable to parse line : not a line"}}, errors, "The third line should have been rejected")
+}
+
+func Test_Router_Ingest_TSV(t *testing.T) {
+	router := Router(index.EmptyIndex(), ingestConfig())
+
+	response := post(router, "/1/ingest", "text/tab-separated-values", constant.CorrectLine+"\nnot a line\n"+constant.DateAsString+constant.Tab+"http://other-url\n")
+	assert.Equal(t, http.StatusOK, response.Code, "Ingestion should succeed")
+	assert.JSONEq(t, `{"accepted": 2, "rejected": 1, "errors": [{"line": 2, "error": "Unable to parse line : not a line"}]}`, response.Body.String(), "Two lines should have been accepted")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015-08-01")
+	assert.JSONEq(t, `{"count": 2}`, response.Body.String(), "Ingested queries should be searchable")
+}
+
+func Test_Router_Ingest_NDJSON(t *testing.T) {
+	router := Router(index.EmptyIndex(), ingestConfig())
+
+	response := post(router, "/1/ingest", "application/x-ndjson", `{"time": "2015-08-01T00:03:43Z", "url": "algolia"}`+"\n"+`{"url": "no date"}`)
+	assert.Equal(t, http.StatusOK, response.Code, "Ingestion should succeed")
+	assert.JSONEq(t, `{"accepted": 1, "rejected": 1, "errors": [{"line": 2, "error": "Unable to find date field time in : {\"url\": \"no date\"}"}]}`, response.Body.String(), "One line should have been accepted")
+
+	response = serve(router, http.MethodGet, "/1/queries/popular/2015?size=1")
+	assert.JSONEq(t, `{"queries": [{"query": "algolia", "count": 1}], "size": 1, "clamped": false}`, response.Body.String(), "Ingested queries should be searchable")
+}
+
+func Test_ParseLines_LongLine_ShouldBeRejectedAlone(t *testing.T) {
+	long := constant.DateAsString + constant.Tab + strings.Repeat("a", MaxLineLength)
+	body := constant.CorrectLine + "\n" + long + "\n" + constant.CorrectLine + "\n" + long
+	parsedQueries, errors, err := ParseLines(strings.NewReader(body), IngestFormat(""))
+
+	assert.NoError(t, err, "A long line should not fail the whole body")
+	assert.Equal(t, 2, len(parsedQueries), "The lines around a long line should be parsed")
+	tooLong := "Line longer than " + strconv.Itoa(MaxLineLength) + " bytes"
+	assert.Equal(t, []IngestError{{2, tooLong}, {4, tooLong}}, errors, "Long lines should be rejected, the last one included")
+
+	parsedQueries, errors, _ = ParseLines(strings.NewReader(strings.Repeat("a", MaxLineLength)), IngestFormat(""))
+	assert.Equal(t, []IngestError{{1, "Unable to parse line : " + strings.Repeat("a", MaxLineLength)}}, errors, "A line of the maximum length should be parsed")
+	assert.Empty(t, parsedQueries, "A line of the maximum length should be parsed")
+}
+
+func Test_Router_Ingest_TooLarge_ShouldAddNothing(t *testing.T) {
+	configuration := ingestConfig()
+	configuration.MaxIngestBytes = int64(len(constant.CorrectLine) + 1)
+	router := Router(index.EmptyIndex(), configuration)
+
+	response := post(router, "/1/ingest", "text/tab-separated-values", constant.CorrectLine+"\n"+constant.CorrectLine+"\n")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code, "A body longer than the limit should be rejected")
+	assert.Equal(t, CodeBodyTooLarge, apiError(response.Body.Bytes()).Code, "A body longer than the limit should be rejected")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.JSONEq(t, `{"count": 0}`, response.Body.String(), "No line of a body longer than the limit should be added")
+
+	response = post(router, "/1/ingest", "text/tab-separated-values", constant.CorrectLine+"\n")
+	assert.Equal(t, http.StatusOK, response.Code, "A body within the limit should be ingested")
+}
+
+func Test_Router_Ingest_ShouldLogFirstRejectedLines(t *testing.T) {
+	var buffer bytes.Buffer
+	server := NewServer(index.EmptyIndex(), ingestConfig())
+	server.logger = logging.New(&buffer, logging.Info)
+
+	request := httptest.NewRequest(http.MethodPost, "/1/ingest", strings.NewReader(strings.Repeat("not a query\n", loggedRejections+2)+constant.CorrectLine))
+	request.Header.Set("Authorization", "Bearer "+ingestToken)
+	request.Header.Set(requestIDHeader, "shipper-id")
+	server.Router.ServeHTTP(httptest.NewRecorder(), request)
+
+	rejections, summaries := 0, []map[string]interface{}{}
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		var logged map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &logged), "Every line should be logged as JSON")
+		switch logged["message"] {
+		case "Could not parse ingested line":
+			rejections++
+			assert.Equal(t, "warn", logged["level"], "A rejected line should be logged as a warning")
+			assert.Equal(t, "shipper-id", logged["request_id"], "The request ID should be logged")
+			assert.Equal(t, float64(rejections), logged["line"], "The line number should be logged")
+		case "More ingested lines could not be parsed":
+			summaries = append(summaries, logged)
+		}
+	}
+
+	assert.Equal(t, loggedRejections, rejections, "Only the first rejected lines should be logged one by one")
+	assert.Equal(t, 1, len(summaries), "The other rejected lines should be summed up")
+	assert.Equal(t, float64(loggedRejections+2), summaries[0]["rejected"], "Every rejected line should be counted")
+}
@@ -0,0 +1,181 @@
+package endpoint
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/query"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+const (
+	// The datePrefix of the live leaderboard, GET /1/queries/popular/live
+	liveDatePrefix = "live"
+	liveQueriesURL = v1queries + "/popular/" + liveDatePrefix
+
+	eventStreamContentType = "text/event-stream"
+
+	// The window query parameter, the trailing period of the live leaderboard
+	windowParam = "window"
+
+	defaultWindow = 5 * time.Minute
+	maxWindow     = 24 * time.Hour
+
+	// How often a live leaderboard is recomputed : the window slides even when no query is ingested
+	defaultLiveRefresh = time.Second
+
+	// How often a comment is sent when the leaderboard does not change, so that proxies keep the connection open
+	liveHeartbeat = 15 * time.Second
+)
+
+// LiveLeaderboard : an update of the live leaderboard, the most popular queries made during the minutes overlapping from-to
+type LiveLeaderboard struct {
+	Queries []query.QueryResult `json:"queries"`
+	Window  string              `json:"window"`
+	From    time.Time           `json:"from"`
+	To      time.Time           `json:"to"`
+	Size    int                 `json:"size"`
+	Clamped bool                `json:"clamped"`
+}
+
+// CloseStreams : ends every live leaderboard, as they would never end otherwise.
+// To be called when the server shuts down, see http.Server.RegisterOnShutdown.
+func (server *Server) CloseStreams() {
+	server.closeStreams.Do(func() {
+		close(server.streamsClosed)
+	})
+}
+
+// orLive : serves the live leaderboard in place of the rest of the handler chain when the datePrefix is "live".
+// gin cannot route /popular/live apart from /popular/:datePrefix.
+func orLive(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if context.Param(datePrefixParam) != liveDatePrefix {
+			context.Next()
+			return
+		}
+
+		context.Abort()
+		server.streamLeaderboard(context)
+	}
+}
+
+// CheckWindow : checks the validity of the window query parameter, a duration from a minute to a day (e.g. 5m, 1h30m).
+// A missing window is 5 minutes.
+func CheckWindow(window string) (time.Duration, error) {
+	if window == "" {
+		return defaultWindow, nil
+	}
+
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration < time.Minute || duration > maxWindow {
+		return 0, &APIError{Code: CodeInvalidParameter, Message: "Wrong window parameter : " + window + " is not a duration from 1m to 24h",
+			Field: windowParam, Details: gin.H{"minimum": "1m", "maximum": "24h"}, status: http.StatusBadRequest}
+	}
+
+	return duration, nil
+}
+
+// streamLeaderboard : streams the most popular queries over the trailing window as Server-Sent Events, every time they change.
+// The first event is sent right away. When the leaderboard cannot be computed anymore, e.g. once re-indexing dropped the filtered
+// dimension, an error event holding the error is sent and the stream ends.
+func (server *Server) streamLeaderboard(context *gin.Context) {
+	window, windowError := CheckWindow(context.Query(windowParam))
+	if windowError != nil {
+		abort(context, windowError)
+		return
+	}
+
+	defaultSize, maxSize := server.config().Sizes()
+	n, clamped, sizeError := CheckSize(context.Query(sizeParam), defaultSize, maxSize)
+	if sizeError != nil {
+		abort(context, sizeError)
+		return
+	}
+	context.Set(sizeParam, n)
+
+	filters := Filters(context.Request.URL.Query())
+	if _, filterError := server.leaderboard(time.Now().UTC(), window, n, filters); filterError != nil {
+		abort(context, filterError)
+		return
+	}
+
+	context.Header("Content-Type", eventStreamContentType)
+	context.Header("Cache-Control", "no-cache")
+	context.Header("X-Accel-Buffering", "no")
+	context.Status(http.StatusOK)
+
+	refresh := time.NewTicker(server.liveRefresh)
+	defer refresh.Stop()
+
+	var sent []query.QueryResult
+	var computed livePeriod
+	lastWrite, id := time.Time{}, 0
+	for {
+		now := time.Now().UTC()
+
+		// The leaderboard only changes with the index, or when the window slides over another minute
+		changed := false
+		if period := server.livePeriod(now, window); sent == nil || period != computed {
+			queries, err := server.leaderboard(now, window, n, filters)
+			if err != nil {
+				context.Render(-1, sse.Event{Id: strconv.Itoa(id + 1), Event: "error", Data: gin.H{"error": AsAPIError(err)}})
+				context.Writer.Flush()
+				return
+			}
+			changed = sent == nil || !reflect.DeepEqual(queries, sent)
+			sent, computed = queries, period
+		}
+
+		if changed {
+			id++
+			context.Render(-1, sse.Event{Id: strconv.Itoa(id), Event: "popular", Data: LiveLeaderboard{sent, window.String(), now.Add(-window), now, n, clamped}})
+			lastWrite = now
+			context.Writer.Flush()
+		} else if now.Sub(lastWrite) >= liveHeartbeat {
+			context.Writer.WriteString(": heartbeat\n\n")
+			lastWrite = now
+			context.Writer.Flush()
+		}
+
+		select {
+		case <-context.Request.Context().Done():
+			return
+		case <-server.streamsClosed:
+			return
+		case <-refresh.C:
+		}
+	}
+}
+
+// livePeriod : what a live leaderboard depends on, the version of the index and the minutes its window starts and ends in
+type livePeriod struct {
+	version uint64
+	from    util.Key
+	to      util.Key
+}
+
+// livePeriod : the period of the window ending at to, as of the current version of the index
+func (server *Server) livePeriod(to time.Time, window time.Duration) livePeriod {
+	server.live.RLock()
+	defer server.live.RUnlock()
+
+	return livePeriod{server.live.index.Version, util.MinuteKey(to.Add(-window)), util.MinuteKey(to)}
+}
+
+// leaderboard : the top n queries over the window ending at to, never nil
+func (server *Server) leaderboard(to time.Time, window time.Duration, n int, filters map[string]string) ([]query.QueryResult, error) {
+	server.live.RLock()
+	defer server.live.RUnlock()
+
+	filteredIndex, err := server.live.index.Filter(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.FindTopNQueriesBetween(filteredIndex, to.Add(-window), to, n), nil
+}
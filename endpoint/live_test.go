@@ -0,0 +1,168 @@
+package endpoint
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/query"
+)
+
+func addQuery(index *index.Index, date time.Time, url string) {
+	parsedQuery, _ := parser.ParseHNQuery(date.UTC().Format(constant.DateFormat) + constant.Tab + url)
+	index.Add(parsedQuery)
+}
+
+// events : reads the data of the SSE events of a live leaderboard, until count events are read
+func events(t *testing.T, scanner *bufio.Scanner, count int) []LiveLeaderboard {
+	leaderboards := []LiveLeaderboard{}
+	for len(leaderboards) < count && scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var leaderboard LiveLeaderboard
+		assert.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &leaderboard), "Every event should hold a leaderboard")
+		leaderboards = append(leaderboards, leaderboard)
+	}
+
+	return leaderboards
+}
+
+func Test_CheckWindow_ShouldAcceptDurationsFromAMinuteToADay(t *testing.T) {
+	window, err := CheckWindow("")
+	assert.Equal(t, 5*time.Minute, window, "A missing window should be 5 minutes")
+	assert.Nil(t, err, "A missing window is an acceptable window parameter")
+
+	window, err = CheckWindow("1h30m")
+	assert.Equal(t, 90*time.Minute, window, "A window should be parsed as a duration")
+	assert.Nil(t, err, "1h30m is an acceptable window parameter")
+
+	for _, window := range []string{"foo", "30s", "25h", "-5m"} {
+		_, err := CheckWindow(window)
+		assert.Equal(t, windowParam, AsAPIError(err).Field, "A window that is not a duration from 1m to 24h should be rejected : "+window)
+	}
+}
+
+func Test_Live_ShouldStreamLeaderboardWhenItChanges(t *testing.T) {
+	now := time.Now()
+	index := index.EmptyIndex()
+	addQuery(index, now, "http://url-1")
+	addQuery(index, now.Add(-time.Hour), "http://url-2")
+
+	server := NewServer(index, config.Default())
+	server.liveRefresh = 10 * time.Millisecond
+	httpServer := httptest.NewServer(server.Router)
+	defer httpServer.Close()
+
+	streamContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, _ := http.NewRequestWithContext(streamContext, http.MethodGet, httpServer.URL+"/1/queries/popular/live?window=10m&size=5", nil)
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err, "The live leaderboard should be streamed")
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode, "The live leaderboard should be streamed")
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"), "The live leaderboard should be streamed as Server-Sent Events")
+
+	scanner := bufio.NewScanner(response.Body)
+	first := events(t, scanner, 1)
+	assert.Equal(t, []query.QueryResult{{Query: "http://url-1", Count: 1}}, first[0].Queries, "Only the queries of the window should be counted")
+	assert.Equal(t, "10m0s", first[0].Window, "The window should be reported")
+	assert.Equal(t, 5, first[0].Size, "The size should be reported")
+
+	server.live.Lock()
+	addQuery(index, now, "http://url-3")
+	addQuery(index, now, "http://url-3")
+	server.live.Unlock()
+
+	second := events(t, scanner, 1)
+	assert.Equal(t, []query.QueryResult{{Query: "http://url-3", Count: 2}, {Query: "http://url-1", Count: 1}}, second[0].Queries, "A change of the leaderboard should be streamed")
+}
+
+func Test_Live_ShouldEndWhenStreamsAreClosed(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), config.Default())
+	server.liveRefresh = 10 * time.Millisecond
+	httpServer := httptest.NewServer(server.Router)
+	defer httpServer.Close()
+
+	response, err := http.Get(httpServer.URL + "/1/queries/popular/live")
+	assert.Nil(t, err, "The live leaderboard should be streamed")
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	assert.Equal(t, 1, len(events(t, scanner, 1)), "The leaderboard should be sent right away, even when empty")
+
+	server.CloseStreams()
+	server.CloseStreams()
+	for scanner.Scan() {
+	}
+	assert.Nil(t, scanner.Err(), "The stream should end once streams are closed")
+}
+
+func Test_Live_WrongParameters_ShouldBeRejected(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	response := serve(router, http.MethodGet, "/1/queries/popular/live?window=1s")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "A window shorter than a minute should be rejected")
+
+	response = serve(router, http.MethodGet, "/1/queries/popular/live?size=0")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "A size of 0 should be rejected")
+
+	response = serve(router, http.MethodGet, "/1/queries/popular/live?filter.country=FR&filter.user=alice")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "Filtering on two dimensions should be rejected")
+}
+
+func Test_LivePeriod_ShouldOnlyChangeWithIndexOrMinute(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), config.Default())
+	to := time.Date(2021, 1, 1, 0, 4, 10, 0, time.UTC)
+
+	period := server.livePeriod(to, 5*time.Minute)
+	assert.Equal(t, period, server.livePeriod(to.Add(30*time.Second), 5*time.Minute), "A window sliding within the same minutes should not be recomputed")
+	assert.NotEqual(t, period, server.livePeriod(to.Add(time.Minute), 5*time.Minute), "A window sliding over another minute should be recomputed")
+	assert.NotEqual(t, period, server.livePeriod(to, 5*time.Minute+30*time.Second), "A window starting in another minute should be recomputed")
+
+	addQuery(server.live.index, to, "http://url-1")
+	assert.NotEqual(t, period, server.livePeriod(to, 5*time.Minute), "A change of the index should be recomputed")
+}
+
+func Test_Live_ShouldStreamEmptyLeaderboardOnceDimensionIsGone(t *testing.T) {
+	filtered := index.EmptyIndex()
+	parsedQuery, _ := parser.ParseHNQuery(time.Now().UTC().Format(constant.DateFormat) + constant.Tab + "http://url-1")
+	parsedQuery.Attributes = map[string]string{"country": "FR"}
+	filtered.Add(parsedQuery)
+
+	server := NewServer(filtered, config.Default())
+	server.liveRefresh = 10 * time.Millisecond
+	httpServer := httptest.NewServer(server.Router)
+	defer httpServer.Close()
+
+	streamContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, _ := http.NewRequestWithContext(streamContext, http.MethodGet, httpServer.URL+"/1/queries/popular/live?filter.country=FR", nil)
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err, "The live leaderboard should be streamed")
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	first := events(t, scanner, 1)
+	assert.Equal(t, []query.QueryResult{{Query: "http://url-1", Count: 1}}, first[0].Queries, "The filtered leaderboard should be sent right away")
+
+	// Re-indexing sources without the country dimension
+	server.live.swap(index.EmptyIndex())
+
+	second := events(t, scanner, 1)
+	assert.NotNil(t, second[0].Queries, "Queries should never be null")
+	assert.Empty(t, second[0].Queries, "No query should carry a dimension the index does not have anymore")
+}
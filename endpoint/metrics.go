@@ -0,0 +1,40 @@
+package endpoint
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/metrics"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+const metricsURL = "/metrics"
+
+// instrument : records the latency and status code of every request, by route and granularity of the date prefix
+func instrument(metrics *metrics.Metrics) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		context.Next()
+
+		endpoint := context.FullPath()
+		if endpoint == "" {
+			endpoint = "unmatched"
+		}
+
+		metrics.ObserveRequest(endpoint, granularity(context.Param(datePrefixParam)), context.Writer.Status(), time.Since(start))
+	}
+}
+
+// granularity : the granularity label of a date prefix, empty when the endpoint takes none and live for the live leaderboard
+func granularity(datePrefix string) string {
+	if datePrefix == "" || datePrefix == liveDatePrefix {
+		return datePrefix
+	}
+
+	keyType, err := util.IdentifyKey(datePrefix)
+	if err != nil {
+		return "invalid"
+	}
+
+	return keyType.String()
+}
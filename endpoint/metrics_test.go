@@ -0,0 +1,32 @@
+package endpoint
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+)
+
+func Test_Granularity_ShouldNameDatePrefix(t *testing.T) {
+	assert.Equal(t, "month", granularity("2015-08"), "2015-08 should be a month")
+	assert.Equal(t, "invalid", granularity("2015-8"), "2015-8 should not be a supported date prefix")
+	assert.Equal(t, "", granularity(""), "No date prefix should have no granularity")
+}
+
+func Test_Router_Metrics_ShouldExposeRequestsAndIngestion(t *testing.T) {
+	router := Router(index.EmptyIndex(), ingestConfig())
+	serve(router, http.MethodGet, "/1/queries/count/2015-08")
+	post(router, "/1/ingest", "text/tab-separated-values", constant.CorrectLine+"\nnot a line\n")
+
+	response := serve(router, http.MethodGet, "/metrics")
+	assert.Equal(t, http.StatusOK, response.Code, "Metrics should be served")
+
+	body := response.Body.String()
+	assert.Contains(t, body, `hnq_http_requests_total{code="200",endpoint="/1/queries/count/:datePrefix",granularity="month"} 1`, "The count request should be recorded")
+	assert.Contains(t, body, `hnq_query_duration_seconds_count{granularity="month",query="count"} 1`, "The count query latency should be recorded")
+	assert.Contains(t, body, `hnq_ingested_lines_total{status="indexed"} 1`, "The indexed line should be recorded")
+	assert.Contains(t, body, `hnq_ingested_lines_total{status="rejected"} 1`, "The rejected line should be recorded")
+	assert.Contains(t, body, "hnq_index_urls 1", "The ingested URL should be in the index size")
+}
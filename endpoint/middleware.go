@@ -0,0 +1,340 @@
+package endpoint
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/logging"
+)
+
+const (
+	// The header carrying the ID of a request, set by the client or else generated
+	requestIDHeader = "X-Request-ID"
+
+	// Where the ID of a request is kept in its context
+	requestIDKey = "requestID"
+)
+
+// Response headers pages of other origins may read
+var exposedHeaders = []string{"ETag", "Retry-After", "X-Request-ID", "X-Size", "X-Size-Clamped"}
+
+// IDs of requests set by clients are kept when they match this pattern, and replaced otherwise
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// middlewares : what every request goes through before its handler, as configured
+func (server *Server) middlewares() []gin.HandlerFunc {
+	configuration := server.config()
+
+	middlewares := []gin.HandlerFunc{recovery(server), requestID}
+	if configuration.AccessLog {
+		middlewares = append(middlewares, accessLog(server))
+	}
+	middlewares = append(middlewares, cors(server))
+	if configuration.Gzip {
+		middlewares = append(middlewares, compress)
+	}
+
+	return append(middlewares, instrument(server.metrics))
+}
+
+// requestID : identifies the request, with the ID its client sent or else a random one, and sends the ID back.
+// The access log writes it too.
+func requestID(context *gin.Context) {
+	id := context.GetHeader(requestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		id = randomID()
+	}
+
+	context.Set(requestIDKey, id)
+	context.Header(requestIDHeader, id)
+	context.Next()
+}
+
+// randomID : 16 random hexadecimal characters, identifying a request or a server (see etag)
+func randomID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// accessLog : logs every request once served, with the date prefix and the size it asked for, if any.
+// Server errors are logged as errors, and client errors as warnings.
+func accessLog(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		context.Next()
+
+		status := context.Writer.Status()
+		fields := logging.Fields{
+			"request_id": context.GetString(requestIDKey),
+			"method":     context.Request.Method,
+			"path":       context.Request.URL.Path,
+			"route":      context.FullPath(),
+			"status":     status,
+			"latency":    time.Since(start).Seconds(),
+			"client_ip":  context.ClientIP(),
+			"bytes":      context.Writer.Size(),
+		}
+		if prefix := context.Param(datePrefixParam); prefix != "" {
+			fields["prefix"] = prefix
+		}
+		if size, found := context.Get(sizeParam); found {
+			fields["size"] = size
+		}
+		if key, found := context.Get(apiKeyName); found {
+			fields["api_key"] = key
+		}
+		if len(context.Errors) > 0 {
+			fields["error"] = context.Errors.String()
+		}
+
+		level := logging.Info
+		if status >= http.StatusInternalServerError {
+			level = logging.Error
+		} else if status >= http.StatusBadRequest {
+			level = logging.Warn
+		}
+		server.log().Log(level, "Request served", fields)
+	}
+}
+
+// recovery : answers 500 to requests whose handler panicked, and logs the panic
+func recovery(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			server.log().Error("Request handler panicked", logging.Fields{
+				"request_id": context.GetString(requestIDKey),
+				"path":       context.Request.URL.Path,
+				"panic":      fmt.Sprint(recovered),
+				"stack":      string(debug.Stack()),
+			})
+			abort(context, &APIError{Code: CodeInternal, Message: "The request could not be served", status: http.StatusInternalServerError})
+		}()
+
+		context.Next()
+	}
+}
+
+// cors : lets pages of the allowed origins call the API, and answers their preflight requests.
+// Requests from other origins are served without CORS headers, so that browsers do not let those pages read the answer.
+func cors(server *Server) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		origin := context.GetHeader("Origin")
+		if origin == "" {
+			context.Next()
+			return
+		}
+
+		settings := server.config().CORS
+		if !allowOrigin(context.Writer.Header(), origin, settings) {
+			context.Next()
+			return
+		}
+
+		if context.Request.Method != http.MethodOptions || context.GetHeader("Access-Control-Request-Method") == "" {
+			context.Next()
+			return
+		}
+
+		context.Header("Access-Control-Allow-Methods", strings.Join(settings.Methods(), ", "))
+		context.Header("Access-Control-Allow-Headers", strings.Join(settings.Headers(), ", "))
+		if settings.MaxAge > 0 {
+			context.Header("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(settings.MaxAge).Seconds())))
+		}
+		context.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// allowOrigin : sets the headers letting pages of origin read the answer, when the settings allow it
+func allowOrigin(header http.Header, origin string, settings config.CORS) bool {
+	addVary(header, "Origin")
+	if !settings.Allows(origin) {
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+	return true
+}
+
+// compress : compresses the answer when the client accepts gzip
+func compress(context *gin.Context) {
+	if !acceptsGzip(context.GetHeader("Accept-Encoding")) {
+		context.Next()
+		return
+	}
+
+	vary(context, "Accept-Encoding")
+	writer := &gzipWriter{ResponseWriter: context.Writer}
+	context.Writer = writer
+	context.Next()
+	writer.close()
+}
+
+// acceptsGzip : whether an Accept-Encoding header accepts gzip, with a q-value above 0 (e.g. not "gzip;q=0").
+// "*" stands for gzip when gzip is not listed.
+func acceptsGzip(acceptEncoding string) bool {
+	accepted, listed, wildcard := false, false, false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := parseQuality(part)
+		switch strings.ToLower(coding) {
+		case "gzip", "x-gzip":
+			listed = true
+			accepted = accepted || q > 0
+		case "*":
+			wildcard = q > 0
+		}
+	}
+
+	return accepted || (!listed && wildcard)
+}
+
+// parseQuality : the coding of an Accept-Encoding element and its q-value, 1 when missing and 0 when invalid
+func parseQuality(element string) (string, float64) {
+	parameters := strings.Split(element, ";")
+	coding, q := strings.TrimSpace(parameters[0]), 1.0
+	for _, parameter := range parameters[1:] {
+		name, value, found := strings.Cut(strings.TrimSpace(parameter), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || parsed < 0 {
+			parsed = 0
+		}
+		q = parsed
+	}
+
+	return coding, q
+}
+
+// gzipWriter : compresses what is written. Compression only starts with the first write, so that answers without body keep having none.
+// As the compressed answer is not the same bytes, its ETag becomes weak.
+// Answers the handler already encoded (e.g. /metrics, compressed by promhttp) are written as they are.
+type gzipWriter struct {
+	gin.ResponseWriter
+	compressor *gzip.Writer
+	encoded    bool
+}
+
+func (writer *gzipWriter) Write(data []byte) (int, error) {
+	if writer.encoded || (writer.compressor == nil && writer.Header().Get("Content-Encoding") != "") {
+		writer.encoded = true
+		return writer.ResponseWriter.Write(data)
+	}
+
+	if writer.compressor == nil {
+		writer.Header().Set("Content-Encoding", "gzip")
+		writer.Header().Del("Content-Length")
+		if etag := writer.Header().Get("ETag"); strings.HasPrefix(etag, `"`) {
+			writer.Header().Set("ETag", "W/"+etag)
+		}
+		writer.compressor = gzip.NewWriter(writer.ResponseWriter)
+	}
+
+	return writer.compressor.Write(data)
+}
+
+func (writer *gzipWriter) WriteString(data string) (int, error) {
+	return writer.Write([]byte(data))
+}
+
+// Flush : sends what was compressed so far, e.g. for live streams
+func (writer *gzipWriter) Flush() {
+	if writer.compressor != nil {
+		writer.compressor.Flush()
+	}
+	writer.ResponseWriter.Flush()
+}
+
+func (writer *gzipWriter) close() {
+	if writer.compressor != nil {
+		writer.compressor.Close()
+	}
+}
+
+// vary : adds name to the Vary header of the answer, unless it already holds it
+func vary(context *gin.Context, name string) {
+	addVary(context.Writer.Header(), name)
+}
+
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, varied := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(varied), name) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", name)
+}
+
+// Handler : the router, answering 503 to requests that are not served within the request timeout.
+// Live streams are not timed out, and neither are ingestion and re-indexing : their handler would keep on changing the index
+// after the 503, and a client retrying would add the same queries twice.
+// Reading requests is limited by the server, see config.Config.ReadTimeout.
+func (server *Server) Handler() http.Handler {
+	timeout := time.Duration(server.config().RequestTimeout)
+	if timeout <= 0 {
+		return server.Router
+	}
+
+	body, _ := json.Marshal(gin.H{"error": &APIError{Code: CodeTimeout, Message: "The request could not be served within " + timeout.String()}})
+	timed := http.TimeoutHandler(server.Router, timeout, string(body))
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case liveQueriesURL, ingestURL, reindexURL:
+			server.Router.ServeHTTP(writer, request)
+			return
+		}
+
+		// The ID is set before the router sees the request, so that the timeout answer can send it back too
+		if !requestIDPattern.MatchString(request.Header.Get(requestIDHeader)) {
+			request.Header.Set(requestIDHeader, randomID())
+		}
+
+		timed.ServeHTTP(timeoutWriter{writer, server, request}, request)
+	})
+}
+
+// timeoutWriter : sets the headers of the error http.TimeoutHandler answers with, which drops the ones the middlewares set :
+// its Content-Type, the request ID and the CORS headers. Every other answer sets its own Content-Type.
+type timeoutWriter struct {
+	http.ResponseWriter
+	server  *Server
+	request *http.Request
+}
+
+func (writer timeoutWriter) WriteHeader(status int) {
+	header := writer.Header()
+	if status == http.StatusServiceUnavailable && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", gin.MIMEJSON+"; charset=utf-8")
+		header.Set(requestIDHeader, writer.request.Header.Get(requestIDHeader))
+		if origin := writer.request.Header.Get("Origin"); origin != "" {
+			allowOrigin(header, origin, writer.server.config().CORS)
+		}
+	}
+	writer.ResponseWriter.WriteHeader(status)
+}
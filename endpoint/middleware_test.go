@@ -0,0 +1,223 @@
+package endpoint
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/logging"
+)
+
+func Test_RequestID_ShouldBeSentBack(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	response := serve(router, http.MethodGet, "/healthz")
+	assert.Regexp(t, "^[0-9a-f]{16}$", response.Header().Get(requestIDHeader), "A request without ID should be given one")
+
+	response = serveWithHeaders(router, "/healthz", map[string]string{requestIDHeader: "client-id.42"})
+	assert.Equal(t, "client-id.42", response.Header().Get(requestIDHeader), "The ID sent by the client should be kept")
+
+	response = serveWithHeaders(router, "/healthz", map[string]string{requestIDHeader: "not an id\t"})
+	assert.Regexp(t, "^[0-9a-f]{16}$", response.Header().Get(requestIDHeader), "An invalid ID should be replaced")
+}
+
+func Test_CORS_ShouldOnlyAllowConfiguredOrigins(t *testing.T) {
+	configuration := config.Default()
+	configuration.CORS = config.CORS{AllowedOrigins: []string{"https://dashboard.example.com"}, MaxAge: config.Duration(10 * time.Minute)}
+	router := Router(index.EmptyIndex(), configuration)
+
+	response := serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Origin": "https://dashboard.example.com"})
+	assert.Equal(t, http.StatusOK, response.Code, "A request from an allowed origin should be served")
+	assert.Equal(t, "https://dashboard.example.com", response.Header().Get("Access-Control-Allow-Origin"), "An allowed origin should be told so")
+	assert.Contains(t, response.Header().Get("Access-Control-Expose-Headers"), "ETag", "The headers of the API should be readable")
+
+	response = serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Origin": "https://evil.example.com"})
+	assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"), "Another origin should not be allowed")
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodOptions, "/1/queries/count/2015", nil)
+	request.Header.Set("Origin", "https://dashboard.example.com")
+	request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusNoContent, recorder.Code, "A preflight request should be answered")
+	assert.Equal(t, "GET, POST", recorder.Header().Get("Access-Control-Allow-Methods"), "The default methods should be allowed")
+	assert.Contains(t, recorder.Header().Get("Access-Control-Allow-Headers"), apiKeyHeader, "API keys should be allowed")
+	assert.Equal(t, "600", recorder.Header().Get("Access-Control-Max-Age"), "The preflight answer should be cached for max age")
+}
+
+func Test_Gzip_ShouldCompressWhenAccepted(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	response := serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Accept-Encoding": "gzip, deflate"})
+	assert.Equal(t, "gzip", response.Header().Get("Content-Encoding"), "The answer should be compressed")
+	assert.Regexp(t, `^W/"`, response.Header().Get("ETag"), "The ETag of a compressed answer should be weak")
+	reader, err := gzip.NewReader(response.Body)
+	assert.NoError(t, err, "The answer should be gzip")
+	body, _ := ioutil.ReadAll(reader)
+	assert.JSONEq(t, `{"count": 0}`, string(body), "The answer should be compressed as is")
+
+	response = serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": response.Header().Get("ETag")})
+	assert.Equal(t, http.StatusNotModified, response.Code, "A weak ETag should still match")
+	assert.Empty(t, response.Header().Get("Content-Encoding"), "An answer without body should not be compressed")
+	assert.Empty(t, response.Body.Bytes(), "An answer without body should stay without body")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015")
+	assert.Empty(t, response.Header().Get("Content-Encoding"), "The answer should not be compressed when gzip is not accepted")
+}
+
+func Test_Gzip_ShouldFollowQualityValues(t *testing.T) {
+	for acceptEncoding, accepted := range map[string]bool{
+		"gzip":                true,
+		"deflate, gzip;q=0.5": true,
+		"GZIP; Q=1":           true,
+		"*":                   true,
+		"gzip;q=0":            false,
+		"gzip;q=0.0, *":       false,
+		"*;q=0":               false,
+		"deflate":             false,
+		"":                    false,
+	} {
+		assert.Equal(t, accepted, acceptsGzip(acceptEncoding), "Accept-Encoding: "+acceptEncoding)
+	}
+
+	router := Router(index.EmptyIndex(), config.Default())
+	response := serveWithHeaders(router, "/1/queries/count/2015", map[string]string{"Accept-Encoding": "gzip;q=0"})
+	assert.Empty(t, response.Header().Get("Content-Encoding"), "The answer should not be compressed when gzip is refused")
+}
+
+func Test_Gzip_Metrics_ShouldBeCompressedOnce(t *testing.T) {
+	server := NewServer(index.EmptyIndex(), config.Default())
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/metrics", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	response, err := (&http.Transport{DisableCompression: true}).RoundTrip(request)
+	assert.NoError(t, err, "Metrics should be scraped")
+	defer response.Body.Close()
+
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"), "Metrics should be compressed")
+	reader, err := gzip.NewReader(response.Body)
+	assert.NoError(t, err, "Metrics should be gzip")
+	body, _ := ioutil.ReadAll(reader)
+	assert.Contains(t, string(body), "# HELP", "Metrics should be compressed once, and read as text once uncompressed")
+}
+
+func Test_Handler_ShouldTimeOutRequestsButLiveStreams(t *testing.T) {
+	configuration := config.Default()
+	configuration.RequestTimeout = config.Duration(10 * time.Millisecond)
+	configuration.CORS.AllowedOrigins = []string{"https://dashboard.example.com"}
+	server := NewServer(index.EmptyIndex(), configuration)
+	server.Router.GET("/slow", func(context *gin.Context) {
+		time.Sleep(100 * time.Millisecond)
+	})
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	response, err := http.Get(httpServer.URL + "/slow")
+	assert.NoError(t, err, "A slow request should be answered")
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode, "A request served for longer than the timeout should be answered with a 503")
+	assert.Equal(t, CodeTimeout, apiError(body).Code, "A timed out request should be told so")
+	assert.Contains(t, response.Header.Get("Content-Type"), gin.MIMEJSON, "The timeout error should be JSON")
+
+	request, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/slow", nil)
+	request.Header.Set("Origin", "https://dashboard.example.com")
+	request.Header.Set(requestIDHeader, "client-id")
+	response, err = http.DefaultClient.Do(request)
+	assert.NoError(t, err, "A slow request should be answered")
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode, "A request served for longer than the timeout should be answered with a 503")
+	assert.Equal(t, "client-id", response.Header.Get(requestIDHeader), "A timed out request should send its ID back")
+	assert.Equal(t, "https://dashboard.example.com", response.Header.Get("Access-Control-Allow-Origin"), "Browsers should be able to read a timed out request")
+
+	response, err = http.Get(httpServer.URL + "/slow")
+	assert.NoError(t, err, "A slow request should be answered")
+	defer response.Body.Close()
+	assert.NotEmpty(t, response.Header.Get(requestIDHeader), "A timed out request without ID should be sent the one it was given")
+
+	response, err = http.Get(httpServer.URL + "/1/queries/popular/live")
+	assert.NoError(t, err, "The live leaderboard should be streamed")
+	defer response.Body.Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Live streams should not time out")
+	assert.Equal(t, 1, len(events(t, bufio.NewScanner(response.Body), 1)), "Live streams should be served past the timeout")
+	server.CloseStreams()
+}
+
+func Test_Handler_ShouldNotTimeOutIngestion(t *testing.T) {
+	configuration := ingestConfig()
+	configuration.RequestTimeout = config.Duration(10 * time.Millisecond)
+	server := NewServer(index.EmptyIndex(), configuration)
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	// The index is held while the request is served, so that ingestion takes longer than the timeout
+	server.live.RLock()
+	time.AfterFunc(50*time.Millisecond, server.live.RUnlock)
+	request, _ := http.NewRequest(http.MethodPost, httpServer.URL+"/1/ingest", strings.NewReader(constant.CorrectLine))
+	request.Header.Set("Authorization", "Bearer "+ingestToken)
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err, "Ingestion should be answered")
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Ingestion should not time out, as its queries are added anyway")
+
+	response, err = http.Get(httpServer.URL + "/1/queries/count/2015")
+	assert.NoError(t, err, "Queries should be answered")
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.JSONEq(t, `{"count": 1}`, string(body), "The queries ingested should be added once")
+}
+
+func Test_AccessLog_ShouldLogRequestsAsJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	server := NewServer(index.EmptyIndex(), config.Default())
+	server.logger = logging.New(&buffer, logging.Info)
+
+	serveWithHeaders(server.Router, "/1/queries/popular/2015?size=5", map[string]string{requestIDHeader: "client-id"})
+	var logged map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &logged), "A request should be logged as a JSON line")
+	assert.Equal(t, "info", logged["level"], "A served request should be logged as info")
+	assert.Equal(t, "client-id", logged["request_id"], "The request ID should be logged")
+	assert.Equal(t, "2015", logged["prefix"], "The date prefix should be logged")
+	assert.Equal(t, 5.0, logged["size"], "The size should be logged")
+	assert.Equal(t, 200.0, logged["status"], "The status should be logged")
+	assert.Equal(t, popularQueriesURL, logged["route"], "The route should be logged")
+	assert.Contains(t, logged, "latency", "The latency should be logged")
+
+	buffer.Reset()
+	serve(server.Router, http.MethodGet, "/1/queries/count/2015-13")
+	json.Unmarshal(buffer.Bytes(), &logged)
+	assert.Equal(t, "warn", logged["level"], "A rejected request should be logged as a warning")
+}
+
+func Test_Recovery_ShouldAnswerAndLogPanics(t *testing.T) {
+	var buffer bytes.Buffer
+	server := NewServer(index.EmptyIndex(), &config.Config{})
+	server.logger = logging.New(&buffer, logging.Info)
+	server.Router.GET("/panic", func(context *gin.Context) {
+		panic("oops")
+	})
+
+	response := serve(server.Router, http.MethodGet, "/panic")
+	assert.Equal(t, http.StatusInternalServerError, response.Code, "A panic should be answered with a 500")
+	assert.Equal(t, CodeInternal, apiError(response.Body.Bytes()).Code, "A panic should be answered with an internal error")
+
+	var logged map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &logged), "A panic should be logged as a JSON line")
+	assert.Equal(t, "error", logged["level"], "A panic should be logged as an error")
+	assert.Equal(t, "oops", logged["panic"], "What the handler panicked with should be logged")
+}
@@ -0,0 +1,563 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const openAPIURL = "/1/openapi.json"
+
+// The pattern of the date prefixes the API supports : year, year-month, year-month-day or year-month-day hour:minute
+const datePrefixPattern = "^[0-9]{4}(-[0-9]{2}(-[0-9]{2}( [0-9]{2}:[0-9]{2})?)?)?$"
+
+// OpenAPI : the subset of an OpenAPI 3 document describing the API
+type OpenAPI struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info : metadata of the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem : the operations of a path, by lowercase HTTP method
+type PathItem map[string]*Operation
+
+// Operation : a single endpoint
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Description string              `json:"description,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// RequestBody : the body an operation expects
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Parameter : a path or query parameter of an operation. An empty query parameter is taken as a missing one.
+type Parameter struct {
+	Name            string  `json:"name"`
+	In              string  `json:"in"`
+	Description     string  `json:"description,omitempty"`
+	Required        bool    `json:"required"`
+	AllowEmptyValue bool    `json:"allowEmptyValue,omitempty"`
+	Schema          *Schema `json:"schema"`
+}
+
+// Response : a response of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType : the schema of a response body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components : the schemas operations refer to
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Schema : the subset of JSON schema the API uses. An object with properties has no other one, unless AdditionalProperties describes them.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Minimum     *int               `json:"minimum,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	Example     interface{}        `json:"example,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+}
+
+// Specification : the OpenAPI document of the v1 query endpoints. Requests to them are validated against it.
+func Specification() *OpenAPI {
+	one, maxQueries := 1, maxBatchSize
+	datePrefix := Parameter{
+		Name:        datePrefixParam,
+		In:          "path",
+		Description: "The period to search : a year (2015), a month (2015-08), a day (2015-08-01) or a minute (2015-08-01 00:03)",
+		Required:    true,
+		Schema:      &Schema{Type: "string", Pattern: datePrefixPattern, Example: "2015-08-01"},
+	}
+	size := Parameter{
+		Name:            sizeParam,
+		In:              "query",
+		Description:     "The number of queries to return. Defaults to the size the server is configured with, and is clamped to its maximum size.",
+		Required:        false,
+		AllowEmptyValue: true,
+		Schema:          &Schema{Type: "integer", Minimum: &one, Example: 10},
+	}
+	format := Parameter{
+		Name:            formatParam,
+		In:              "query",
+		Description:     "The format of the response, overriding the Accept header (application/json, text/csv, application/x-ndjson or text/plain)",
+		Required:        false,
+		AllowEmptyValue: true,
+		Schema:          &Schema{Type: "string", Enum: FormatNames},
+	}
+	window := Parameter{
+		Name:            windowParam,
+		In:              "query",
+		Description:     "The trailing period to rank the queries of, from 1m to 24h. Defaults to 5m.",
+		Required:        false,
+		AllowEmptyValue: true,
+		Schema:          &Schema{Type: "string", Example: "5m"},
+	}
+	filters := "A query parameter prefixed with filter. filters on an attribute of the queries (e.g. ?filter.country=FR), " +
+		"an attribute never seen giving no query. Only one filter can be applied at once. Other query parameters are ignored."
+
+	return &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "HN queries",
+			Description: "Counts and ranks the queries made to HN Search over a period of time",
+			Version:     "1",
+		},
+		Paths: map[string]PathItem{
+			openAPIPath(countQueriesURL): {
+				"get": {
+					OperationID: "countQueries",
+					Summary:     "Counts the distinct queries made during a period",
+					Description: filters,
+					Parameters:  []Parameter{datePrefix, format},
+					Responses:   responses(schemaRef("CountResult")),
+				},
+			},
+			openAPIPath(popularQueriesURL): {
+				"get": {
+					OperationID: "popularQueries",
+					Summary:     "Lists the most popular queries made during a period, the most popular first",
+					Description: filters,
+					Parameters:  []Parameter{datePrefix, size, format},
+					Responses:   responses(schemaRef("PopularResult")),
+				},
+			},
+			liveQueriesURL: {
+				"get": {
+					OperationID: "livePopularQueries",
+					Summary:     "Streams the most popular queries made during a trailing window as Server-Sent Events, every time they change",
+					Description: "Each popular event holds a LiveLeaderboard. Should the leaderboard not be computed anymore, an error event holds the Error and the stream ends. " + filters,
+					Parameters:  []Parameter{window, size},
+					Responses: map[string]Response{
+						"200": {Description: "OK", Content: map[string]MediaType{eventStreamContentType: {schemaRef("LiveLeaderboard")}}},
+						"400": {Description: "Invalid parameter or filter", Content: map[string]MediaType{gin.MIMEJSON: {schemaRef("Error")}}},
+						"503": {Description: "The index is still loading", Content: map[string]MediaType{gin.MIMEJSON: {schemaRef("Error")}}},
+					},
+				},
+			},
+			batchURL: {
+				"post": {
+					OperationID: "batchQueries",
+					Summary:     "Runs several count, popular or histogram queries against the same index",
+					Description: "A failed query does not fail the batch : its result holds the error instead.",
+					RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{gin.MIMEJSON: {schemaRef("BatchRequest")}}},
+					Responses: map[string]Response{
+						"200": {Description: "OK", Content: map[string]MediaType{gin.MIMEJSON: {schemaRef("BatchResult")}}},
+						"400": {Description: "Invalid batch", Content: map[string]MediaType{gin.MIMEJSON: {schemaRef("Error")}}},
+						"503": {Description: "The index is still loading", Content: map[string]MediaType{gin.MIMEJSON: {schemaRef("Error")}}},
+					},
+				},
+			},
+		},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"CountResult": {
+					Type:       "object",
+					Properties: map[string]*Schema{"count": {Type: "integer"}},
+					Required:   []string{"count"},
+				},
+				"PopularResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"queries": {Type: "array", Items: schemaRef("QueryResult")},
+						"size":    {Type: "integer"},
+						"clamped": {Type: "boolean"},
+					},
+					Required: []string{"queries", "size", "clamped"},
+				},
+				"QueryResult": {
+					Type:       "object",
+					Properties: map[string]*Schema{"query": {Type: "string"}, "count": {Type: "integer"}},
+					Required:   []string{"query", "count"},
+				},
+				"LiveLeaderboard": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"queries": {Type: "array", Items: schemaRef("QueryResult")},
+						"window":  {Type: "string", Example: "5m0s"},
+						"from":    {Type: "string", Format: "date-time"},
+						"to":      {Type: "string", Format: "date-time"},
+						"size":    {Type: "integer"},
+						"clamped": {Type: "boolean"},
+					},
+					Required: []string{"queries", "window", "from", "to", "size", "clamped"},
+				},
+				"BatchRequest": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"queries": {Type: "array", Items: schemaRef("SubQuery"), MinItems: &one, MaxItems: &maxQueries},
+					},
+					Required: []string{"queries"},
+				},
+				"SubQuery": {
+					Type:        "object",
+					Description: "The values of a query are checked as it runs : a query of an unknown type, or with a wrong datePrefix, size or interval, fails alone.",
+					Properties: map[string]*Schema{
+						"id":         {Type: "string"},
+						"type":       {Type: "string", Description: "count, popular or histogram"},
+						"datePrefix": {Type: "string", Description: "Matches " + datePrefixPattern, Example: "2015-08-01"},
+						"size":       {Type: "integer", Description: "At least 1, popular queries only"},
+						"interval":   {Type: "string", Description: "month, day, hour or minute, histogram queries only"},
+						"filters":    {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+					},
+					Required: []string{"type", "datePrefix"},
+				},
+				"BatchResult": {
+					Type:       "object",
+					Properties: map[string]*Schema{"results": {Type: "array", Items: schemaRef("SubResult")}},
+					Required:   []string{"results"},
+				},
+				"SubResult": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"id":      {Type: "string"},
+						"type":    {Type: "string"},
+						"count":   {Type: "integer"},
+						"queries": {Type: "array", Items: schemaRef("QueryResult")},
+						"size":    {Type: "integer"},
+						"clamped": {Type: "boolean"},
+						"buckets": {Type: "array", Items: schemaRef("Bucket")},
+						"error":   schemaRef("APIError"),
+					},
+					Required: []string{"type"},
+				},
+				"Bucket": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"start": {Type: "string", Format: "date-time"},
+						"count": {Type: "integer"},
+						"total": {Type: "integer"},
+					},
+					Required: []string{"start", "count", "total"},
+				},
+				"Error": {
+					Type:       "object",
+					Properties: map[string]*Schema{"error": schemaRef("APIError")},
+					Required:   []string{"error"},
+				},
+				"APIError": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"code":    {Type: "string", Example: CodeInvalidParameter},
+						"message": {Type: "string"},
+						"field":   {Type: "string", Example: datePrefixParam},
+						"details": {Type: "object"},
+					},
+					Required: []string{"code", "message"},
+				},
+			},
+		},
+	}
+}
+
+// Operation : the operation of a route (e.g. GET /1/queries/count/:datePrefix), or nil when the document does not describe it
+func (document *OpenAPI) Operation(method, route string) *Operation {
+	return document.Paths[openAPIPath(route)][strings.ToLower(method)]
+}
+
+func responses(success *Schema) map[string]Response {
+	failure := map[string]MediaType{gin.MIMEJSON: {schemaRef("Error")}}
+
+	return map[string]Response{
+		"200": {Description: "OK", Content: map[string]MediaType{
+			gin.MIMEJSON:      {success},
+			csvContentType:    {&Schema{Type: "string"}},
+			ndjsonContentType: {&Schema{Type: "string"}},
+			textContentType:   {&Schema{Type: "string"}},
+		}},
+		"304": {Description: "The answer did not change since the ETag sent as If-None-Match"},
+		"400": {Description: "Invalid parameter or filter", Content: failure},
+		"401": {Description: "Missing or unknown API key", Content: failure},
+		"403": {Description: "The API key is not granted the query role", Content: failure},
+		"406": {Description: "None of the accepted media types is supported", Content: failure},
+		"429": {Description: "Too many requests for the API key, to be retried after Retry-After seconds", Content: failure},
+		"500": {Description: "The search failed", Content: failure},
+		"503": {Description: "The index is still loading", Content: failure},
+	}
+}
+
+// The prefix of the references to the schemas of the components
+const schemaPrefix = "#/components/schemas/"
+
+func schemaRef(name string) *Schema {
+	return &Schema{Ref: schemaPrefix + name}
+}
+
+// openAPIPath : converts a gin route to an OpenAPI path (e.g. /count/:datePrefix => /count/{datePrefix})
+func openAPIPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// openAPI : serves the document
+func openAPI(document *OpenAPI) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		context.JSON(http.StatusOK, document)
+	}
+}
+
+// validate : rejects with a 400 the requests whose parameters do not match those of the operation
+func validate(operation *Operation) gin.HandlerFunc {
+	validators := make([]func(*gin.Context) *APIError, 0, len(operation.Parameters))
+	for _, parameter := range operation.Parameters {
+		validators = append(validators, parameter.validator())
+	}
+
+	return func(context *gin.Context) {
+		for _, validator := range validators {
+			if err := validator(context); err != nil {
+				abort(context, err)
+				return
+			}
+		}
+
+		context.Next()
+	}
+}
+
+// validator : checks the presence of a parameter and its value against its schema
+func (parameter Parameter) validator() func(*gin.Context) *APIError {
+	var pattern *regexp.Regexp
+	if parameter.Schema.Pattern != "" {
+		pattern = regexp.MustCompile(parameter.Schema.Pattern)
+	}
+
+	return func(context *gin.Context) *APIError {
+		value, present := parameter.value(context)
+		if !present {
+			if parameter.Required {
+				return parameter.invalid(CodeMissingParameter, "Missing "+parameter.In+" parameter : "+parameter.Name, nil)
+			}
+			return nil
+		}
+
+		if pattern != nil && !pattern.MatchString(value) {
+			return parameter.invalid(CodeInvalidParameter, "Incorrect "+parameter.Name+" parameter : "+value+" does not match "+parameter.Schema.Pattern,
+				gin.H{"pattern": parameter.Schema.Pattern})
+		}
+
+		if enum := parameter.Schema.Enum; len(enum) > 0 && !contains(enum, value) {
+			return parameter.invalid(CodeInvalidParameter, "Incorrect "+parameter.Name+" parameter : "+value+" is not one of "+strings.Join(enum, ", "),
+				gin.H{"enum": enum})
+		}
+
+		if parameter.Schema.Type == "integer" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return parameter.invalid(CodeInvalidParameter, "Incorrect "+parameter.Name+" parameter : "+value+" is not an integer", gin.H{"type": "integer"})
+			}
+
+			if minimum := parameter.Schema.Minimum; minimum != nil && n < *minimum {
+				return parameter.invalid(CodeInvalidParameter, "Incorrect "+parameter.Name+" parameter : "+value+" is lower than "+strconv.Itoa(*minimum),
+					gin.H{"minimum": *minimum})
+			}
+		}
+
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (parameter Parameter) invalid(code, message string, details interface{}) *APIError {
+	return &APIError{Code: code, Message: message, Field: parameter.Name, Details: details, status: http.StatusBadRequest}
+}
+
+// value : the value of the parameter, and whether it is present. An empty query parameter is missing, as the handlers take it (see CheckSize).
+func (parameter Parameter) value(context *gin.Context) (string, bool) {
+	value := context.Param(parameter.Name)
+	if parameter.In != "path" {
+		value = context.Query(parameter.Name)
+	}
+
+	return value, value != ""
+}
+
+// validateBody : rejects with a 400 the requests whose JSON body does not match the schema of the operation.
+// The body is left for the handler to read.
+func validateBody(document *OpenAPI, operation *Operation) gin.HandlerFunc {
+	schema := operation.RequestBody.Content[gin.MIMEJSON].Schema
+
+	return func(context *gin.Context) {
+		body, err := io.ReadAll(context.Request.Body)
+		if err != nil {
+			abort(context, &APIError{Code: CodeInvalidBody, Message: "Could not read body : " + err.Error(), status: http.StatusBadRequest})
+			return
+		}
+
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			abort(context, &APIError{Code: CodeInvalidBody, Message: "Could not read body : " + err.Error(), status: http.StatusBadRequest})
+			return
+		}
+
+		if err := document.check(schema, value, ""); err != nil {
+			abort(context, err)
+			return
+		}
+
+		context.Request.Body = io.NopCloser(bytes.NewReader(body))
+		context.Next()
+	}
+}
+
+// check : the first mismatch between a JSON value, decoded with numbers as json.Number, and its schema. path locates the value in the body (e.g. queries[0].size).
+func (document *OpenAPI) check(schema *Schema, value interface{}, path string) *APIError {
+	if schema.Ref != "" {
+		return document.check(document.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaPrefix)], value, path)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return mismatch(path, "is not an object", gin.H{"type": schema.Type})
+		}
+
+		for _, name := range schema.Required {
+			if _, found := object[name]; !found {
+				return mismatch(property(path, name), "is missing", nil)
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propertySchema, found := schema.Properties[name]
+			if !found {
+				propertySchema = schema.AdditionalProperties
+			}
+			if propertySchema == nil && schema.Properties != nil {
+				return mismatch(property(path, name), "is not expected", nil)
+			}
+			if propertySchema != nil {
+				if err := document.check(propertySchema, object[name], property(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "array":
+		array, isArray := value.([]interface{})
+		if !isArray {
+			return mismatch(path, "is not an array", gin.H{"type": schema.Type})
+		}
+
+		if minItems := schema.MinItems; minItems != nil && len(array) < *minItems {
+			return mismatch(path, "should hold at least "+strconv.Itoa(*minItems)+" items", gin.H{"minItems": *minItems})
+		}
+		if maxItems := schema.MaxItems; maxItems != nil && len(array) > *maxItems {
+			return mismatch(path, "should hold at most "+strconv.Itoa(*maxItems)+" items", gin.H{"maxItems": *maxItems})
+		}
+
+		for i, item := range array {
+			if err := document.check(schema.Items, item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		text, isString := value.(string)
+		if !isString {
+			return mismatch(path, "is not a string", gin.H{"type": schema.Type})
+		}
+
+		if matched, _ := regexp.MatchString(schema.Pattern, text); !matched {
+			return mismatch(path, "does not match "+schema.Pattern, gin.H{"pattern": schema.Pattern})
+		}
+		if enum := schema.Enum; len(enum) > 0 && !contains(enum, text) {
+			return mismatch(path, "is not one of "+strings.Join(enum, ", "), gin.H{"enum": enum})
+		}
+
+	case "integer":
+		number, isNumber := value.(json.Number)
+		n, err := number.Int64()
+		if !isNumber || err != nil {
+			return mismatch(path, "is not an integer", gin.H{"type": schema.Type})
+		}
+
+		if minimum := schema.Minimum; minimum != nil && n < int64(*minimum) {
+			return mismatch(path, "is lower than "+strconv.Itoa(*minimum), gin.H{"minimum": *minimum})
+		}
+
+	case "boolean":
+		if _, isBoolean := value.(bool); !isBoolean {
+			return mismatch(path, "is not a boolean", gin.H{"type": schema.Type})
+		}
+	}
+
+	return nil
+}
+
+func property(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func mismatch(path, reason string, details interface{}) *APIError {
+	if path == "" {
+		path = "body"
+	}
+
+	return &APIError{Code: CodeInvalidBody, Message: "Incorrect body : " + path + " " + reason, Field: path, Details: details, status: http.StatusBadRequest}
+}
@@ -0,0 +1,86 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/index"
+)
+
+func Test_OpenAPIPath_ShouldConvertRouteParameters(t *testing.T) {
+	assert.Equal(t, "/1/queries/count/{datePrefix}", openAPIPath(countQueriesURL), "Route parameters should be converted to OpenAPI ones")
+}
+
+func Test_Specification_ShouldDescribeQueryEndpoints(t *testing.T) {
+	specification := Specification()
+	assert.NotNil(t, specification.Operation(http.MethodGet, countQueriesURL), "The count endpoint should be described")
+	assert.NotNil(t, specification.Operation(http.MethodGet, popularQueriesURL), "The popular endpoint should be described")
+	assert.Nil(t, specification.Operation(http.MethodPost, countQueriesURL), "Only GET should be described")
+}
+
+func Test_DatePrefixPattern_ShouldMatchSupportedPrefixes(t *testing.T) {
+	pattern := regexp.MustCompile(datePrefixPattern)
+	for _, datePrefix := range []string{"2015", "2015-08", "2015-08-01", "2015-08-01 00:03"} {
+		assert.True(t, pattern.MatchString(datePrefix), "Supported date prefix should match : "+datePrefix)
+	}
+	for _, datePrefix := range []string{"15", "2015-8", "2015-08-01 00", "2015-08-01T00:03"} {
+		assert.False(t, pattern.MatchString(datePrefix), "Unsupported date prefix should not match : "+datePrefix)
+	}
+}
+
+func Test_Router_OpenAPI_ShouldServeSpecification(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+	response := serve(router, http.MethodGet, "/1/openapi.json")
+	assert.Equal(t, http.StatusOK, response.Code, "The specification should be served")
+
+	var document map[string]interface{}
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &document), "The specification should be JSON")
+	assert.Equal(t, "3.0.3", document["openapi"], "The specification should be an OpenAPI 3 document")
+	assert.Contains(t, document["paths"], "/1/queries/popular/{datePrefix}", "The popular endpoint should be described")
+}
+
+func Test_Router_ShouldValidateParameters(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	for target, message := range map[string]string{
+		"/1/queries/count/2015-8":          "Incorrect datePrefix parameter : 2015-8 does not match " + datePrefixPattern,
+		"/1/queries/popular/2015?size=foo": "Incorrect size parameter : foo is not an integer",
+		"/1/queries/popular/2015?size=0":   "Incorrect size parameter : 0 is lower than 1",
+	} {
+		response := serve(router, http.MethodGet, target)
+		assert.Equal(t, http.StatusBadRequest, response.Code, "Request should be rejected : "+target)
+
+		var body struct{ Error APIError }
+		json.Unmarshal(response.Body.Bytes(), &body)
+		assert.Equal(t, message, body.Error.Message, "Rejection should explain why : "+target)
+	}
+
+	response := serve(router, http.MethodGet, "/1/queries/popular/2015-08-01%2000:03?size=1")
+	assert.Equal(t, http.StatusOK, response.Code, "A valid request should be served")
+
+	response = serve(router, http.MethodGet, "/1/queries/popular/2015?size=&format=")
+	assert.Equal(t, http.StatusOK, response.Code, "Empty parameters should be taken as missing ones")
+}
+
+func Test_Router_ShouldValidateBatchBody(t *testing.T) {
+	router := Router(index.EmptyIndex(), config.Default())
+
+	for body, message := range map[string]string{
+		`[]`:                               "Incorrect body : body is not an object",
+		`{"queries": []}`:                  "Incorrect body : queries should hold at least 1 items",
+		`{"queries": [{"type": "count"}]}`: "Incorrect body : queries[0].datePrefix is missing",
+		`{"queries": [{"type": "count", "datePrefix": 2015}]}`:                              "Incorrect body : queries[0].datePrefix is not a string",
+		`{"queries": [{"type": "popular", "datePrefix": "2015", "size": 1.5}]}`:             "Incorrect body : queries[0].size is not an integer",
+		`{"queries": [{"type": "count", "datePrefix": "2015", "filters": {"country": 1}}]}`: "Incorrect body : queries[0].filters.country is not a string",
+		`{"queries": [{"type": "count", "datePrefix": "2015", "unknown": 1}]}`:              "Incorrect body : queries[0].unknown is not expected",
+	} {
+		response := post(router, "/1/queries/batch", "application/json", body)
+		assert.Equal(t, http.StatusBadRequest, response.Code, "Body should be rejected : "+body)
+		assert.Equal(t, CodeInvalidBody, apiError(response.Body.Bytes()).Code, "Body should be an invalid body : "+body)
+		assert.Equal(t, message, apiError(response.Body.Bytes()).Message, "Rejection should explain why : "+body)
+	}
+}
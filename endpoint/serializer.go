@@ -0,0 +1,269 @@
+package endpoint
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/query"
+)
+
+// The format query parameter, overriding the Accept header
+const formatParam = "format"
+
+// Media types the query endpoints can answer with, JSON being the default
+const (
+	csvContentType  = "text/csv"
+	textContentType = "text/plain"
+)
+
+// Result : a response of the query endpoints. The JSON serializer writes Document,
+// the other ones write Rows, whose values are named by Columns. Headers are set whatever the format.
+type Result struct {
+	Document interface{}
+	Columns  []string
+	Rows     [][]interface{}
+	Headers  map[string]string
+}
+
+// CountResult : the response of the count endpoint
+func CountResult(count int) Result {
+	return Result{
+		Document: gin.H{"count": count},
+		Columns:  []string{"count"},
+		Rows:     [][]interface{}{{count}},
+	}
+}
+
+// PopularResult : the response of the popular endpoint. As only JSON has room for them,
+// the size applied and whether it was clamped are also sent as the X-Size and X-Size-Clamped headers.
+func PopularResult(queries []query.QueryResult, size int, clamped bool) Result {
+	rows := make([][]interface{}, 0, len(queries))
+	for _, queryResult := range queries {
+		rows = append(rows, []interface{}{queryResult.Query, queryResult.Count})
+	}
+
+	return Result{
+		Document: gin.H{"queries": queries, "size": size, "clamped": clamped},
+		Columns:  []string{"query", "count"},
+		Rows:     rows,
+		Headers:  map[string]string{"X-Size": strconv.Itoa(size), "X-Size-Clamped": strconv.FormatBool(clamped)},
+	}
+}
+
+// Serializer : writes results in a media type
+type Serializer interface {
+	ContentType() string
+	Serialize(writer io.Writer, result Result) error
+}
+
+// Serializers : the serializers by name of the format query parameter
+var Serializers = map[string]Serializer{
+	"json":   JSONSerializer{},
+	"csv":    CSVSerializer{},
+	"ndjson": NDJSONSerializer{},
+	"text":   TextSerializer{},
+}
+
+// FormatNames : the values the format query parameter accepts
+var FormatNames = []string{"json", "csv", "ndjson", "text"}
+
+// JSONSerializer : writes the document of a result
+type JSONSerializer struct{}
+
+// ContentType : application/json
+func (JSONSerializer) ContentType() string {
+	return gin.MIMEJSON
+}
+
+// Serialize : writes the document of the result
+func (JSONSerializer) Serialize(writer io.Writer, result Result) error {
+	return json.NewEncoder(writer).Encode(result.Document)
+}
+
+// CSVSerializer : writes the columns of a result as a header line, then one line per row
+type CSVSerializer struct{}
+
+// ContentType : text/csv
+func (CSVSerializer) ContentType() string {
+	return csvContentType
+}
+
+// Serialize : writes the header line, then the rows
+func (CSVSerializer) Serialize(writer io.Writer, result Result) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(result.Columns); err != nil {
+		return err
+	}
+
+	for _, row := range result.Rows {
+		if err := csvWriter.Write(texts(row)); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// NDJSONSerializer : writes each row of a result as a JSON object on its own line
+type NDJSONSerializer struct{}
+
+// ContentType : application/x-ndjson
+func (NDJSONSerializer) ContentType() string {
+	return ndjsonContentType
+}
+
+// Serialize : writes one JSON object per row, keyed by the columns
+func (NDJSONSerializer) Serialize(writer io.Writer, result Result) error {
+	encoder := json.NewEncoder(writer)
+	for _, row := range result.Rows {
+		object := make(map[string]interface{}, len(row))
+		for i, value := range row {
+			object[result.Columns[i]] = value
+		}
+
+		if err := encoder.Encode(object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TextSerializer : writes each row of a result on its own line, values being separated by tabs
+type TextSerializer struct{}
+
+// ContentType : text/plain
+func (TextSerializer) ContentType() string {
+	return textContentType
+}
+
+// Serialize : writes one tab separated line per row, without header
+func (TextSerializer) Serialize(writer io.Writer, result Result) error {
+	for _, row := range result.Rows {
+		if _, err := io.WriteString(writer, strings.Join(texts(row), "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func texts(row []interface{}) []string {
+	values := make([]string, len(row))
+	for i, value := range row {
+		values[i] = fmt.Sprint(value)
+	}
+
+	return values
+}
+
+// Negotiate : picks the serializer named by the format query parameter, or else the one of the preferred media type of the Accept header.
+// JSON is picked when neither asks for anything in particular.
+func Negotiate(format, accept string) (Serializer, error) {
+	if format != "" {
+		serializer, found := Serializers[format]
+		if !found {
+			return nil, &APIError{Code: CodeInvalidParameter, Message: "Unknown format : " + format, Field: formatParam,
+				Details: gin.H{"enum": FormatNames}, status: http.StatusBadRequest}
+		}
+		return serializer, nil
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return JSONSerializer{}, nil
+	}
+
+	for _, mediaType := range acceptedMediaTypes(accept) {
+		if mediaType == "*/*" || mediaType == "application/*" {
+			return JSONSerializer{}, nil
+		}
+		if mediaType == "text/*" {
+			return TextSerializer{}, nil
+		}
+
+		for _, name := range FormatNames {
+			if Serializers[name].ContentType() == mediaType {
+				return Serializers[name], nil
+			}
+		}
+	}
+
+	return nil, &APIError{Code: CodeNotAcceptable, Message: "None of the accepted media types is supported : " + accept,
+		Details: gin.H{"supported": supportedContentTypes()}, status: http.StatusNotAcceptable}
+}
+
+// acceptedMediaTypes : the media types of an Accept header, the preferred first. Media types with a zero quality are left out.
+func acceptedMediaTypes(accept string) []string {
+	type accepted struct {
+		mediaType string
+		quality   float64
+	}
+
+	candidates := []accepted{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, parameters, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := parameters["q"]; found {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		if quality > 0 {
+			candidates = append(candidates, accepted{mediaType, quality})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	mediaTypes := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		mediaTypes[i] = candidate.mediaType
+	}
+
+	return mediaTypes
+}
+
+func supportedContentTypes() []string {
+	contentTypes := make([]string, len(FormatNames))
+	for i, name := range FormatNames {
+		contentTypes[i] = Serializers[name].ContentType()
+	}
+
+	return contentTypes
+}
+
+// respond : writes the result in the format the request asks for
+func respond(context *gin.Context, result Result) {
+	serializer, err := Negotiate(context.Query(formatParam), context.GetHeader("Accept"))
+	if err != nil {
+		abort(context, err)
+		return
+	}
+
+	for name, value := range result.Headers {
+		context.Header(name, value)
+	}
+	vary(context, "Accept")
+	context.Header("Content-Type", serializer.ContentType()+"; charset=utf-8")
+	context.Status(http.StatusOK)
+
+	if err := serializer.Serialize(context.Writer, result); err != nil {
+		context.Error(err)
+	}
+}
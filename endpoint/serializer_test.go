@@ -0,0 +1,94 @@
+package endpoint
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/query"
+)
+
+var popular = PopularResult([]query.QueryResult{{Query: "http://an-url", Count: 2}, {Query: "a \"quoted\", query", Count: 1}}, 2, true)
+
+func serialize(t *testing.T, serializer Serializer, result Result) string {
+	var buffer bytes.Buffer
+	assert.NoError(t, serializer.Serialize(&buffer, result), "Result should have been serialized")
+	return buffer.String()
+}
+
+func Test_JSONSerializer_ShouldWriteDocument(t *testing.T) {
+	assert.JSONEq(t, `{"count": 3}`, serialize(t, JSONSerializer{}, CountResult(3)), "Count should be a JSON document")
+	assert.JSONEq(t, `{"queries": [{"query": "http://an-url", "count": 2}, {"query": "a \"quoted\", query", "count": 1}], "size": 2, "clamped": true}`,
+		serialize(t, JSONSerializer{}, popular), "Popular queries should be a JSON document")
+}
+
+func Test_CSVSerializer_ShouldWriteHeaderAndRows(t *testing.T) {
+	assert.Equal(t, "count\n3\n", serialize(t, CSVSerializer{}, CountResult(3)), "Count should be a single CSV row")
+	assert.Equal(t, "query,count\nhttp://an-url,2\n\"a \"\"quoted\"\", query\",1\n", serialize(t, CSVSerializer{}, popular), "Queries should be escaped CSV rows")
+}
+
+func Test_NDJSONSerializer_ShouldWriteOneObjectPerRow(t *testing.T) {
+	assert.Equal(t, "{\"count\":3}\n", serialize(t, NDJSONSerializer{}, CountResult(3)), "Count should be a single JSON line")
+	assert.Equal(t, "{\"count\":2,\"query\":\"http://an-url\"}\n{\"count\":1,\"query\":\"a \\\"quoted\\\", query\"}\n",
+		serialize(t, NDJSONSerializer{}, popular), "Queries should be one JSON line each")
+}
+
+func Test_TextSerializer_ShouldWriteTabSeparatedRows(t *testing.T) {
+	assert.Equal(t, "3\n", serialize(t, TextSerializer{}, CountResult(3)), "Count should be a single line")
+	assert.Equal(t, "http://an-url\t2\na \"quoted\", query\t1\n", serialize(t, TextSerializer{}, popular), "Queries should be tab separated lines")
+}
+
+func Test_Negotiate_ShouldPickSerializer(t *testing.T) {
+	for _, test := range []struct {
+		format, accept string
+		expected       Serializer
+	}{
+		{"", "", JSONSerializer{}},
+		{"", "*/*", JSONSerializer{}},
+		{"", "text/csv", CSVSerializer{}},
+		{"", "application/x-ndjson", NDJSONSerializer{}},
+		{"", "text/plain; charset=utf-8", TextSerializer{}},
+		{"", "text/html, text/csv;q=0.5, text/plain;q=0.8", TextSerializer{}},
+		{"", "text/csv;q=0, */*;q=0.1", JSONSerializer{}},
+		{"csv", "application/json", CSVSerializer{}},
+	} {
+		serializer, err := Negotiate(test.format, test.accept)
+		assert.NoError(t, err, "A serializer should have been found : "+test.format+" "+test.accept)
+		assert.Equal(t, test.expected, serializer, "Wrong serializer : "+test.format+" "+test.accept)
+	}
+}
+
+func Test_Negotiate_ShouldFail(t *testing.T) {
+	_, err := Negotiate("xml", "")
+	assert.Equal(t, http.StatusBadRequest, AsAPIError(err).Status(), "An unknown format should be an invalid parameter")
+
+	_, err = Negotiate("", "application/xml")
+	assert.Equal(t, http.StatusNotAcceptable, AsAPIError(err).Status(), "An unsupported media type should not be acceptable")
+}
+
+func Test_Router_ShouldNegotiateContent(t *testing.T) {
+	index := index.EmptyIndex()
+	parsedQuery, _ := parser.ParseHNQuery(constant.CorrectLine)
+	index.Add(parsedQuery)
+	router := Router(index, config.Default())
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/1/queries/popular/2015?size=5", nil)
+	request.Header.Set("Accept", "text/csv")
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"), "CSV should have been negotiated")
+	assert.Equal(t, "false", recorder.Header().Get("X-Size-Clamped"), "Whether the size was clamped should be sent as a header")
+	assert.Equal(t, "query,count\n"+constant.URLAsString+",1\n", recorder.Body.String(), "Popular queries should be CSV")
+
+	response := serve(router, http.MethodGet, "/1/queries/count/2015?format=text")
+	assert.Equal(t, "1\n", response.Body.String(), "The format parameter should override the Accept header")
+
+	response = serve(router, http.MethodGet, "/1/queries/count/2015?format=xml")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "An unknown format should be rejected")
+}
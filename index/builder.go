@@ -0,0 +1,107 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/thomaspepio/hn-queries/avltree"
+	"github.com/thomaspepio/hn-queries/parser"
+)
+
+// Builder : accumulates parsed queries, then builds an Index in one go.
+// Indexing a whole file this way avoids rebalancing the tree on each query.
+type Builder struct {
+	index      *Index
+	buckets    buckets
+	dimensions map[string]map[string]buckets
+}
+
+// buckets : URL counts by key, waiting to be loaded in a tree
+type buckets map[int]map[int]int
+
+// NewBuilder : creates a builder with no query
+func NewBuilder() *Builder {
+	return &Builder{EmptyIndex(), make(buckets), make(map[string]map[string]buckets)}
+}
+
+// Add : accumulates a parsed query, to be indexed when the index is built
+func (builder *Builder) Add(parsedQuery *parser.ParsedQuery) error {
+	keys, keysError := KeysFrom(parsedQuery)
+
+	if keysError != nil {
+		return keysError
+	}
+
+	urlID := builder.index.idOf(parsedQuery.URL)
+	builder.buckets.add(keys, urlID)
+	for name, value := range parsedQuery.Attributes {
+		values, foundDimension := builder.dimensions[name]
+		if !foundDimension {
+			values = make(map[string]buckets)
+			builder.dimensions[name] = values
+		}
+
+		valueBuckets, foundValue := values[value]
+		if !foundValue {
+			valueBuckets = make(buckets)
+			values[value] = valueBuckets
+		}
+
+		valueBuckets.add(keys, urlID)
+	}
+
+	return nil
+}
+
+// Build : builds a balanced index from the accumulated queries.
+// The builder should not be used afterwards.
+func (builder *Builder) Build() (*Index, error) {
+	tree, treeError := builder.buckets.tree()
+	if treeError != nil {
+		return nil, treeError
+	}
+	builder.index.Tree = tree
+
+	for name, values := range builder.dimensions {
+		builder.index.Dimensions[name] = make(map[string]*avltree.AVLTree, len(values))
+		for value, valueBuckets := range values {
+			valueTree, valueTreeError := valueBuckets.tree()
+			if valueTreeError != nil {
+				return nil, valueTreeError
+			}
+			builder.index.Dimensions[name][value] = valueTree
+		}
+	}
+	builder.index.Version = NextVersion()
+
+	return builder.index, nil
+}
+
+func (buckets buckets) add(keys *IndexKeys, urlID URLId) {
+	for _, key := range keys.indexed() {
+		bucket, foundBucket := buckets[int(key)]
+		if !foundBucket {
+			bucket = make(map[int]int)
+			buckets[int(key)] = bucket
+		}
+		bucket[urlID]++
+	}
+}
+
+// tree : loads the buckets in a balanced tree, along with the root of an empty tree
+func (buckets buckets) tree() (*avltree.AVLTree, error) {
+	root := emptyTree()
+	keys := make([]int, 0, len(buckets)+1)
+	keys = append(keys, root.Key)
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	values := make([]map[int]int, len(keys))
+	values[0] = root.Values
+	for i, key := range keys[1:] {
+		values[i+1] = buckets[key]
+	}
+
+	return avltree.FromSorted(keys, values)
+}
@@ -0,0 +1,84 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+func Test_Builder_Empty_ShouldBuildEmptyIndex(t *testing.T) {
+	index, err := NewBuilder().Build()
+	assert.NoError(t, err, "An empty builder should build an index")
+	expected := EmptyIndex()
+	expected.Version = index.Version
+	assert.Equal(t, expected, index, "An empty builder should build an empty index")
+}
+
+func Test_Builder_ShouldBuildSameIndexAsAdd(t *testing.T) {
+	lines := []string{
+		constant.CorrectLine,
+		constant.CorrectLine,
+		constant.DateAsString + constant.Tab + "http://same-date-other-url",
+		"2015-08-01 00:04:43" + constant.Tab + "http://same-day-other-url",
+		"2021-01-01 00:03:43" + constant.Tab + "http://other-url",
+	}
+
+	expected := EmptyIndex()
+	builder := NewBuilder()
+	for _, line := range lines {
+		parsedQuery, _ := parser.ParseHNQuery(line)
+		expected.Add(parsedQuery)
+		builder.Add(parsedQuery)
+	}
+	actual, err := builder.Build()
+
+	assert.NoError(t, err, "Index should have been built")
+	assert.NoError(t, actual.Tree.Validate(), "Index tree should be valid")
+	assert.Equal(t, expected.URLsToID, actual.URLsToID, "URLs should have the same IDs")
+	assert.Equal(t, expected.IDstoURL, actual.IDstoURL, "IDs should have the same URLs")
+	assert.Equal(t, expected.Tree.Count(), actual.Tree.Count(), "Both trees should have the same keys")
+	expected.Tree.Ascend(func(treeKey int, values map[int]int) bool {
+		assert.Equal(t, values, actual.Tree.Get(treeKey), "Both trees should have the same values")
+		return true
+	})
+
+	parsedQuery, _ := parser.ParseHNQuery("2022-01-01 00:03:43" + constant.Tab + "http://added-after-build")
+	actual.Add(parsedQuery)
+	assert.Equal(t, 1, len(actual.Get(key(util.Year, "2022-01-01 00:00:00"))), "Queries should be added to a built index")
+}
+
+func Test_Builder_CannotParse(t *testing.T) {
+	err := NewBuilder().Add(nil)
+	assert.Error(t, err, "You should not be able to add nil")
+}
+
+func Test_Builder_ShouldBuildDimensions(t *testing.T) {
+	expected := EmptyIndex()
+	builder := NewBuilder()
+	for _, parsedQuery := range []*parser.ParsedQuery{
+		withAttributes(constant.CorrectLine, map[string]string{"country": "FR"}),
+		withAttributes(constant.CorrectLine, map[string]string{"country": "FR", "user": "alice"}),
+		withAttributes("2021-01-01 00:03:43"+constant.Tab+"http://other-url", map[string]string{"country": "US"}),
+	} {
+		expected.Add(parsedQuery)
+		builder.Add(parsedQuery)
+	}
+	actual, err := builder.Build()
+
+	assert.NoError(t, err, "Index should have been built")
+	assert.Equal(t, len(expected.Dimensions), len(actual.Dimensions), "Both indexes should have the same dimensions")
+	for name, values := range expected.Dimensions {
+		for value, tree := range values {
+			actualTree := actual.Dimensions[name][value]
+			assert.NoError(t, actualTree.Validate(), "Dimension trees should be valid")
+			assert.Equal(t, tree.Count(), actualTree.Count(), "Both dimension trees should have the same keys")
+			tree.Ascend(func(treeKey int, values map[int]int) bool {
+				assert.Equal(t, values, actualTree.Get(treeKey), "Both dimension trees should have the same values")
+				return true
+			})
+		}
+	}
+}
@@ -2,6 +2,7 @@ package index
 
 import (
 	"errors"
+	"sync/atomic"
 
 	"github.com/thomaspepio/hn-queries/avltree"
 	"github.com/thomaspepio/hn-queries/parser"
@@ -10,32 +11,52 @@ import (
 
 // Keys represents the different parts of an index key
 // Input : 2021-01-17 11:22:33
-// Key   : Year=20210000000000, Month=20210100000000, Day=20210117000000
-//		   Hour=20210117110000, Minutes=20210117112200, Seconds=20210117112233
+// Key   : Year=2021, Month=2021-01, Day=2021-01-17
+//		   Hour=2021-01-17 11, Minutes=2021-01-17 11:22, Seconds=2021-01-17 11:22:33
+// (see util.Key for how each of them is packed)
 type IndexKeys struct {
-	Year   int
-	Month  int
-	Day    int
-	Hour   int
-	Minute int
-	Second int
+	Year   util.Key
+	Month  util.Key
+	Day    util.Key
+	Hour   util.Key
+	Minute util.Key
+	Second util.Key
 }
 
 // URLId : type alias for int
 type URLId = int
 
 // Index : a datastructure to deduplicate URLs and index them by year, year-month and year-month-day
+// Queries carrying attributes are also indexed in one tree per attribute value (e.g. Dimensions["country"]["FR"]),
+// so that they can be filtered on. Every query is then held once more per attribute it carries, and each distinct value
+// costs a tree of its own : attributes with many distinct values (e.g. the user or ip of CLF sources) make the index grow accordingly.
+// Version changes every time the index does, see NextVersion.
 type Index struct {
-	Sequence int
-	URLsToID map[string]URLId
-	IDstoURL map[URLId]string
-	Tree     *avltree.AVLTree
+	Sequence   int
+	URLsToID   map[string]URLId
+	IDstoURL   map[URLId]string
+	Tree       *avltree.AVLTree
+	Dimensions map[string]map[string]*avltree.AVLTree
+	Version    uint64
+}
+
+// versions : the last version given to an index
+var versions uint64
+
+// NextVersion : a version greater than any version given before, to any index.
+// As versions are shared by every index, an index swapped for another one never gets a version it had before.
+func NextVersion() uint64 {
+	return atomic.AddUint64(&versions, 1)
 }
 
 // EmptyIndex : creates an empty index
 func EmptyIndex() *Index {
-	almostEmptyTree := avltree.New(-1, make(map[int]int))
-	return &Index{0, make(map[string]int), make(map[int]string), almostEmptyTree}
+	return &Index{0, make(map[string]int), make(map[int]string), emptyTree(), make(map[string]map[string]*avltree.AVLTree), NextVersion()}
+}
+
+// Get : lookup the URL counts associated to a key, or nil when nothing was indexed under it
+func (index *Index) Get(key util.Key) map[URLId]int {
+	return index.Tree.Get(int(key))
 }
 
 // Add : indexes a parsed query
@@ -46,69 +67,88 @@ func (index *Index) Add(parsedQuery *parser.ParsedQuery) error {
 		return keysError
 	}
 
-	//url := parsedQuery.URL.String()
-	url := parsedQuery.URL
-	urls := index.URLsToID
-	ids := index.IDstoURL
-	urlID, foundURL := urls[url]
-
-	if !foundURL {
-		sequence := index.Sequence
-		urlID = sequence
-		urls[url] = urlID
-		ids[urlID] = url
+	urlID := index.idOf(parsedQuery.URL)
+	addToTree(index.Tree, keys, urlID)
+	for name, value := range parsedQuery.Attributes {
+		addToTree(index.dimensionTree(name, value), keys, urlID)
 	}
-	index.Sequence++
+	index.Version = NextVersion()
 
-	yearIndex := index.Tree.Get(keys.Year)
-	if yearIndex == nil {
-		index.Tree.Insert(keys.Year, initPairs(urlID))
-	} else {
-		yearIndex[urlID]++
-		index.Tree.Update(keys.Year, yearIndex)
+	return nil
+}
+
+// Filter : a view of the index restricted to the queries carrying the given attribute values.
+// Only one attribute can be filtered on at a time. No filter at all returns the index itself.
+// A dimension or a value never seen gives an empty view, as no query carries it (yet).
+func (index *Index) Filter(filters map[string]string) (*Index, error) {
+	if len(filters) > 1 {
+		return nil, &FilterError{"", "Only one filter can be applied at once"}
 	}
 
-	monthIndex := index.Tree.Get(keys.Month)
-	if monthIndex == nil {
-		index.Tree.Insert(keys.Month, initPairs(urlID))
-	} else {
-		monthIndex[urlID]++
-		index.Tree.Update(keys.Month, monthIndex)
+	for name, value := range filters {
+		tree, foundValue := index.Dimensions[name][value]
+		if !foundValue {
+			tree = emptyTree()
+		}
+
+		return &Index{index.Sequence, index.URLsToID, index.IDstoURL, tree, nil, index.Version}, nil
 	}
 
-	dayIndex := index.Tree.Get(keys.Day)
-	if dayIndex == nil {
-		index.Tree.Insert(keys.Day, initPairs(urlID))
-	} else {
-		dayIndex[urlID]++
-		index.Tree.Update(keys.Day, dayIndex)
+	return index, nil
+}
+
+// FilterError : a filter the index cannot apply. Dimension is empty when the error is not specific to one.
+type FilterError struct {
+	Dimension string
+	Message   string
+}
+
+func (err *FilterError) Error() string {
+	return err.Message
+}
+
+// dimensionTree : returns the tree of an attribute value, creating it when the value was never seen before
+func (index *Index) dimensionTree(name, value string) *avltree.AVLTree {
+	values, foundDimension := index.Dimensions[name]
+	if !foundDimension {
+		values = make(map[string]*avltree.AVLTree)
+		index.Dimensions[name] = values
 	}
 
-	hourIndex := index.Tree.Get(keys.Hour)
-	if hourIndex == nil {
-		index.Tree.Insert(keys.Hour, initPairs(urlID))
-	} else {
-		hourIndex[urlID]++
-		index.Tree.Update(keys.Hour, hourIndex)
+	tree, foundValue := values[value]
+	if !foundValue {
+		tree = emptyTree()
+		values[value] = tree
 	}
 
-	minuteIndex := index.Tree.Get(keys.Minute)
-	if minuteIndex == nil {
-		index.Tree.Insert(keys.Minute, initPairs(urlID))
-	} else {
-		minuteIndex[urlID]++
-		index.Tree.Update(keys.Minute, minuteIndex)
+	return tree
+}
+
+func addToTree(tree *avltree.AVLTree, keys *IndexKeys, urlID URLId) {
+	for _, key := range keys.indexed() {
+		if tree.Get(int(key)) == nil {
+			tree.Insert(int(key), initPairs(urlID))
+		} else {
+			tree.Increment(int(key), urlID)
+		}
 	}
+}
 
-	// secondIndex := index.Tree.Get(keys.Second)
-	// if secondIndex == nil {
-	// 	index.Tree.Insert(keys.Second, initPairs(urlID))
-	// } else {
-	// 	secondIndex[urlID]++
-	// 	index.Tree.Update(keys.Second, secondIndex)
-	// }
+// idOf : returns the ID of an URL, registering it when it was never seen before
+func (index *Index) idOf(url string) URLId {
+	urls := index.URLsToID
+	ids := index.IDstoURL
+	urlID, foundURL := urls[url]
 
-	return nil
+	if !foundURL {
+		sequence := index.Sequence
+		urlID = sequence
+		urls[url] = urlID
+		ids[urlID] = url
+	}
+	index.Sequence++
+
+	return urlID
 }
 
 // KeysFrom : parses a HN Query into a IndexKeys
@@ -127,6 +167,17 @@ func KeysFrom(parsedQuery *parser.ParsedQuery) (*IndexKeys, error) {
 		Second: util.SecondKey(time)}, nil
 }
 
+// indexed : the keys under which a query is indexed.
+// Seconds are left out : the API does not support them, and they would multiply the number of nodes in the tree.
+func (keys *IndexKeys) indexed() []util.Key {
+	return []util.Key{keys.Year, keys.Month, keys.Day, keys.Hour, keys.Minute}
+}
+
+// emptyTree : a tree holding no query. Its root key is lower than any util.Key, so that the tree is never nil.
+func emptyTree() *avltree.AVLTree {
+	return avltree.New(-1, make(map[int]int))
+}
+
 func initPairs(id int) map[int]int {
 	return map[int]int{id: 1}
 }
@@ -2,22 +2,24 @@ package index
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thomaspepio/hn-queries/constant"
 	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/util"
 )
 
 func Test_AVLIndex_DeriveKeys(t *testing.T) {
 	parsedQuery, _ := parser.ParseHNQuery(constant.CorrectLine)
 
 	keys, _ := KeysFrom(parsedQuery)
-	assert.Equal(t, 20150000000000, keys.Year, "Year should be 20150000000000")     // Our design requires that we can extraxt six different keys from each date, padding each possible key with zeroes when necessary.
-	assert.Equal(t, 20150800000000, keys.Month, "Month should be 20150800000000")   // This poses a problem with the hours, minutes or seconds equal to 0.
-	assert.Equal(t, 20150801000000, keys.Day, "Day should be 20150801240000")       // To remedy this : we choose to increment hours/seconds/minutes when represented in the key
-	assert.Equal(t, 20150801010000, keys.Hour, "Hour should be 20150801010000")     // (e.g. there is an hour 24, a minute and a second 60).
-	assert.Equal(t, 20150801010400, keys.Minute, "Second should be 20150801010400") // This allows us to keep the same order between dates and keys.
-	assert.Equal(t, 20150801010444, keys.Second, "Minute should be 20150801010444")
+	assert.Equal(t, key(util.Year, "2015-01-01 00:00:00"), keys.Year, "Year should be 2015")          // Our design requires that we can extraxt six different keys from each date.
+	assert.Equal(t, key(util.Month, "2015-08-01 00:00:00"), keys.Month, "Month should be 2015-08")    // Each key packs its granularity along with the date, so that keys of
+	assert.Equal(t, key(util.Day, "2015-08-01 00:00:00"), keys.Day, "Day should be 2015-08-01")       // different granularities never conflict, even when hours, minutes
+	assert.Equal(t, key(util.Hour, "2015-08-01 00:00:00"), keys.Hour, "Hour should be 2015-08-01 00") // or seconds are equal to 0.
+	assert.Equal(t, key(util.Minute, "2015-08-01 00:03:00"), keys.Minute, "Minute should be 2015-08-01 00:03")
+	assert.Equal(t, key(util.Second, "2015-08-01 00:03:43"), keys.Second, "Second should be 2015-08-01 00:03:43")
 }
 
 func Test_AVLIndex_CannotParse(t *testing.T) {
@@ -42,30 +44,30 @@ func Test_AVLIndex_FromMultipleQueries(t *testing.T) {
 	assert.Equal(t, len(index.IDstoURL), 1, "One url should have been indexed")
 	assert.NotNil(t, index, "Index should not be nil")
 
-	assert.NotNil(t, index.Tree.Get(20150000000000), "There should be a key for 20150000000000")
-	assert.NotNil(t, index.Tree.Get(20150801010000), "There should be a key for 20150801010000")
-	assert.NotNil(t, index.Tree.Get(20150800000000), "There should be a key for 20150800000000")
-	assert.NotNil(t, index.Tree.Get(20150801000000), "There should be a key for 20150801000000")
-	assert.NotNil(t, index.Tree.Get(20150801010400), "There should be a key for 20150801010400")
-	//assert.NotNil(t, index.Tree.Get(20150801010444), "There should be a key for 20150801010444")
-	assert.Equal(t, 1, len(index.Tree.Get(20150000000000)), "The key 20150000000000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20150800000000)), "The key 20150800000000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20150801000000)), "The key 20150801000000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20150801010000)), "The key 20150801010000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20150801010400)), "The key 20150801010400 should have seen one url")
-	//assert.Equal(t, 1, len(index.Tree.Get(20150801010444)), "The key 20150801010444 should have seen one url")
+	assert.NotNil(t, index.Get(key(util.Year, "2015-01-01 00:00:00")), "There should be a key for 2015")
+	assert.NotNil(t, index.Get(key(util.Hour, "2015-08-01 00:00:00")), "There should be a key for 2015-08-01 00")
+	assert.NotNil(t, index.Get(key(util.Month, "2015-08-01 00:00:00")), "There should be a key for 2015-08")
+	assert.NotNil(t, index.Get(key(util.Day, "2015-08-01 00:00:00")), "There should be a key for 2015-08-01")
+	assert.NotNil(t, index.Get(key(util.Minute, "2015-08-01 00:03:00")), "There should be a key for 2015-08-01 00:03")
+	//assert.NotNil(t, index.Get(key(util.Second, "2015-08-01 00:03:43")), "There should be a key for 2015-08-01 00:03:43")
+	assert.Equal(t, 1, len(index.Get(key(util.Year, "2015-01-01 00:00:00"))), "The key 2015 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Month, "2015-08-01 00:00:00"))), "The key 2015-08 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Day, "2015-08-01 00:00:00"))), "The key 2015-08-01 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Hour, "2015-08-01 00:00:00"))), "The key 2015-08-01 00 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Minute, "2015-08-01 00:03:00"))), "The key 2015-08-01 00:03 should have seen one url")
+	//assert.Equal(t, 1, len(index.Get(key(util.Second, "2015-08-01 00:03:43"))), "The key 2015-08-01 00:03:43 should have seen one url")
 
 	newURLAsString := "http://same-date-other-url"
 	parsedQuery, _ = parser.ParseHNQuery(constant.DateAsString + constant.Tab + newURLAsString)
 	index.Add(parsedQuery)
 	assert.Equal(t, len(index.URLsToID), 2, "Two urls should have been indexed")
 	assert.Equal(t, len(index.IDstoURL), 2, "Two urls should have been indexed")
-	assert.Equal(t, 2, len(index.Tree.Get(20150000000000)), "The key 20150000000000 should have seen two urls")
-	assert.Equal(t, 2, len(index.Tree.Get(20150800000000)), "The key 20150800000000 should have seen two urls")
-	assert.Equal(t, 2, len(index.Tree.Get(20150801000000)), "The key 20150801000000 should have seen two urls")
-	assert.Equal(t, 2, len(index.Tree.Get(20150801010000)), "The key 20150801010000 should have seen two url")
-	assert.Equal(t, 2, len(index.Tree.Get(20150801010400)), "The key 20150801010400 should have seen two url")
-	// assert.Equal(t, 2, len(index.Tree.Get(20150801010444)), "The key 20150801010444 should have seen two url")
+	assert.Equal(t, 2, len(index.Get(key(util.Year, "2015-01-01 00:00:00"))), "The key 2015 should have seen two urls")
+	assert.Equal(t, 2, len(index.Get(key(util.Month, "2015-08-01 00:00:00"))), "The key 2015-08 should have seen two urls")
+	assert.Equal(t, 2, len(index.Get(key(util.Day, "2015-08-01 00:00:00"))), "The key 2015-08-01 should have seen two urls")
+	assert.Equal(t, 2, len(index.Get(key(util.Hour, "2015-08-01 00:00:00"))), "The key 2015-08-01 00 should have seen two url")
+	assert.Equal(t, 2, len(index.Get(key(util.Minute, "2015-08-01 00:03:00"))), "The key 2015-08-01 00:03 should have seen two url")
+	// assert.Equal(t, 2, len(index.Get(key(util.Second, "2015-08-01 00:03:43"))), "The key 2015-08-01 00:03:43 should have seen two url")
 
 	newDateAsString := "2021-01-01 00:03:43"
 	newURLAsString = "http://other-url"
@@ -73,12 +75,80 @@ func Test_AVLIndex_FromMultipleQueries(t *testing.T) {
 	index.Add(parsedQuery)
 	assert.Equal(t, len(index.URLsToID), 3, "Three urls should have been indexed")
 	assert.Equal(t, len(index.IDstoURL), 3, "Three urls should have been indexed")
-	assert.Equal(t, 1, len(index.Tree.Get(20210000000000)), "The key 20210000000000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20210000000000)), "The key 20210000000000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20210000000000)), "The key 20210000000000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20210101010000)), "The key 20210101010000 should have seen one url")
-	assert.Equal(t, 1, len(index.Tree.Get(20210101010400)), "The key 20210101010400 should have seen one url")
-	// assert.Equal(t, 1, len(index.Tree.Get(20210101010444)), "The key 20210101010444 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Year, "2021-01-01 00:00:00"))), "The key 2021 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Year, "2021-01-01 00:00:00"))), "The key 2021 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Year, "2021-01-01 00:00:00"))), "The key 2021 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Hour, "2021-01-01 00:00:00"))), "The key 2021-01-01 00 should have seen one url")
+	assert.Equal(t, 1, len(index.Get(key(util.Minute, "2021-01-01 00:03:00"))), "The key 2021-01-01 00:03 should have seen one url")
+	// assert.Equal(t, 1, len(index.Get(key(util.Second, "2021-01-01 00:03:43"))), "The key 2021-01-01 00:03:43 should have seen one url")
+}
+
+func Test_AVLIndex_ShouldIndexAttributes(t *testing.T) {
+	index := EmptyIndex()
+	for _, parsedQuery := range []*parser.ParsedQuery{
+		withAttributes(constant.CorrectLine, map[string]string{"country": "FR", "user": "alice"}),
+		withAttributes(constant.DateAsString+constant.Tab+"http://other-url", map[string]string{"country": "US"}),
+		withAttributes(constant.DateAsString+constant.Tab+"http://no-attribute", nil),
+	} {
+		index.Add(parsedQuery)
+	}
+
+	year := key(util.Year, "2015-01-01 00:00:00")
+	assert.Equal(t, 3, len(index.Get(year)), "Every query should be indexed in the main tree")
+	assert.Equal(t, 2, len(index.Dimensions), "Two dimensions should have been indexed")
+	assert.Equal(t, 2, len(index.Dimensions["country"]), "Two countries should have been indexed")
+
+	france, err := index.Filter(map[string]string{"country": "FR"})
+	assert.NoError(t, err, "Filtering on a known dimension should succeed")
+	assert.Equal(t, map[URLId]int{0: 1}, france.Get(year), "Only the query from France should be found")
+	assert.Equal(t, index.IDstoURL, france.IDstoURL, "A filtered index should share the URLs of the index")
+
+	germany, err := index.Filter(map[string]string{"country": "DE"})
+	assert.NoError(t, err, "Filtering on an unseen value should succeed")
+	assert.Nil(t, germany.Get(year), "No query should be found for an unseen value")
+
+	browser, err := index.Filter(map[string]string{"browser": "firefox"})
+	assert.NoError(t, err, "Filtering on an unseen dimension should succeed")
+	assert.Nil(t, browser.Get(year), "No query should be found for an unseen dimension")
+
+	unfiltered, err := index.Filter(map[string]string{})
+	assert.NoError(t, err, "No filter should succeed")
+	assert.True(t, index == unfiltered, "No filter should return the index itself")
+}
+
+func Test_AVLIndex_Filter_ShouldFail(t *testing.T) {
+	index := EmptyIndex()
+	index.Add(withAttributes(constant.CorrectLine, map[string]string{"country": "FR", "user": "alice"}))
+
+	_, err := index.Filter(map[string]string{"country": "FR", "user": "alice"})
+	assert.Error(t, err, "Filtering on two dimensions should fail")
+}
+
+func Test_AVLIndex_Version_ShouldIncreaseWithEveryChange(t *testing.T) {
+	index := EmptyIndex()
+	empty := index.Version
+
+	index.Add(withAttributes(constant.CorrectLine, map[string]string{"country": "FR"}))
+	assert.Greater(t, index.Version, empty, "Adding a query should increase the version")
+
+	filtered, _ := index.Filter(map[string]string{"country": "FR"})
+	assert.Equal(t, index.Version, filtered.Version, "A filtered view should have the version of its index")
+
+	index.Add(nil)
+	assert.Equal(t, filtered.Version, index.Version, "A query that could not be added should not change the version")
+
+	assert.Greater(t, EmptyIndex().Version, index.Version, "A new index should never get a version given before")
+}
+
+func withAttributes(line string, attributes map[string]string) *parser.ParsedQuery {
+	parsedQuery, _ := parser.ParseHNQuery(line)
+	parsedQuery.Attributes = attributes
+	return parsedQuery
+}
+
+func key(keyType util.KeyType, date string) util.Key {
+	time, _ := time.Parse(constant.DateFormat, date)
+	return util.NewKey(keyType, time)
 }
 
 func mapOf(key, val int) map[int]int {
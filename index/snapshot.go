@@ -0,0 +1,82 @@
+package index
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+
+	"github.com/thomaspepio/hn-queries/avltree"
+)
+
+// snapshot : what is written of an index. URLsToID is rebuilt from IDstoURL on read.
+type snapshot struct {
+	Sequence   int
+	IDstoURL   map[URLId]string
+	Tree       treeSnapshot
+	Dimensions map[string]map[string]treeSnapshot
+}
+
+// treeSnapshot : the keys of a tree in ascending order, along with their values
+type treeSnapshot struct {
+	Keys   []int
+	Values []map[int]int
+}
+
+// WriteSnapshot : writes the whole index, to be read back with ReadSnapshot
+func (index *Index) WriteSnapshot(writer io.Writer) error {
+	dimensions := make(map[string]map[string]treeSnapshot, len(index.Dimensions))
+	for name, values := range index.Dimensions {
+		dimensions[name] = make(map[string]treeSnapshot, len(values))
+		for value, tree := range values {
+			dimensions[name][value] = snapshotOf(tree)
+		}
+	}
+
+	return gob.NewEncoder(writer).Encode(snapshot{index.Sequence, index.IDstoURL, snapshotOf(index.Tree), dimensions})
+}
+
+// ReadSnapshot : reads an index written with WriteSnapshot. Trees are bulk-loaded, already balanced.
+func ReadSnapshot(reader io.Reader) (*Index, error) {
+	var read snapshot
+	if err := gob.NewDecoder(reader).Decode(&read); err != nil {
+		return nil, errors.New("Could not read index snapshot : " + err.Error())
+	}
+
+	index := EmptyIndex()
+	index.Sequence = read.Sequence
+	for id, url := range read.IDstoURL {
+		index.IDstoURL[id] = url
+		index.URLsToID[url] = id
+	}
+
+	tree, err := avltree.FromSorted(read.Tree.Keys, read.Tree.Values)
+	if err != nil {
+		return nil, errors.New("Could not read index snapshot : " + err.Error())
+	}
+	index.Tree = tree
+
+	for name, values := range read.Dimensions {
+		index.Dimensions[name] = make(map[string]*avltree.AVLTree, len(values))
+		for value, treeSnapshot := range values {
+			valueTree, err := avltree.FromSorted(treeSnapshot.Keys, treeSnapshot.Values)
+			if err != nil {
+				return nil, errors.New("Could not read index snapshot : " + err.Error())
+			}
+			index.Dimensions[name][value] = valueTree
+		}
+	}
+
+	return index, nil
+}
+
+func snapshotOf(tree *avltree.AVLTree) treeSnapshot {
+	keys := make([]int, 0, tree.Count())
+	values := make([]map[int]int, 0, tree.Count())
+	tree.Ascend(func(key int, keyValues map[int]int) bool {
+		keys = append(keys, key)
+		values = append(values, keyValues)
+		return true
+	})
+
+	return treeSnapshot{keys, values}
+}
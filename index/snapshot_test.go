@@ -0,0 +1,43 @@
+package index
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/util"
+)
+
+func Test_Snapshot_ShouldRoundTrip(t *testing.T) {
+	expected := EmptyIndex()
+	for _, parsedQuery := range []*parser.ParsedQuery{
+		withAttributes(constant.CorrectLine, map[string]string{"country": "FR"}),
+		withAttributes(constant.CorrectLine, nil),
+		withAttributes("2021-01-01 00:03:43"+constant.Tab+"http://other-url", map[string]string{"country": "US"}),
+	} {
+		expected.Add(parsedQuery)
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(t, expected.WriteSnapshot(&buffer), "Snapshot should have been written")
+	actual, err := ReadSnapshot(&buffer)
+	assert.NoError(t, err, "Snapshot should have been read")
+
+	assert.Equal(t, expected.Sequence, actual.Sequence, "Sequence should have been restored")
+	assert.Equal(t, expected.URLsToID, actual.URLsToID, "URLs should have been restored")
+	assert.Equal(t, expected.IDstoURL, actual.IDstoURL, "IDs should have been restored")
+	assert.NoError(t, actual.Tree.Validate(), "Restored tree should be valid")
+	assert.Equal(t, expected.Tree.Count(), actual.Tree.Count(), "Every key should have been restored")
+	assert.Equal(t, expected.Get(key(util.Year, "2015-01-01 00:00:00")), actual.Get(key(util.Year, "2015-01-01 00:00:00")), "Values should have been restored")
+	assert.Equal(t, expected.Dimensions["country"]["US"].Count(), actual.Dimensions["country"]["US"].Count(), "Dimensions should have been restored")
+
+	actual.Add(withAttributes(constant.CorrectLine, nil))
+	assert.Equal(t, 3, actual.Get(key(util.Year, "2015-01-01 00:00:00"))[0], "Queries should be added to a restored index")
+}
+
+func Test_ReadSnapshot_ShouldFail(t *testing.T) {
+	_, err := ReadSnapshot(bytes.NewBufferString("not a snapshot"))
+	assert.Error(t, err, "Garbage should not be read as a snapshot")
+}
@@ -0,0 +1,144 @@
+package ingestion
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/logging"
+)
+
+// Progress : how far an ingestion went. It is safe to read while the ingestion runs.
+type Progress struct {
+	linesRead     int64
+	linesRejected int64
+	bytesRead     int64
+	totalBytes    int64
+	done          int32
+	startedAt     time.Time
+	observer      func(indexed bool)
+}
+
+// Status : a snapshot of the progress of an ingestion
+type Status struct {
+	LinesRead     int64     `json:"linesRead"`
+	LinesIndexed  int64     `json:"linesIndexed"`
+	LinesRejected int64     `json:"linesRejected"`
+	BytesRead     int64     `json:"bytesRead"`
+	TotalBytes    int64     `json:"totalBytes"`
+	StartedAt     time.Time `json:"startedAt"`
+	Done          bool      `json:"done"`
+}
+
+// NewProgress : a progress for an ingestion starting now
+func NewProgress() *Progress {
+	return &Progress{startedAt: time.Now()}
+}
+
+// Observe : calls observer for every line read, telling whether it was indexed or rejected.
+// It must be called before the ingestion starts.
+func (progress *Progress) Observe(observer func(indexed bool)) {
+	progress.observer = observer
+}
+
+// Status : takes a snapshot of the progress
+func (progress *Progress) Status() Status {
+	linesRead := atomic.LoadInt64(&progress.linesRead)
+	linesRejected := atomic.LoadInt64(&progress.linesRejected)
+
+	return Status{
+		LinesRead:     linesRead,
+		LinesIndexed:  linesRead - linesRejected,
+		LinesRejected: linesRejected,
+		BytesRead:     atomic.LoadInt64(&progress.bytesRead),
+		TotalBytes:    atomic.LoadInt64(&progress.totalBytes),
+		StartedAt:     progress.startedAt,
+		Done:          atomic.LoadInt32(&progress.done) == 1,
+	}
+}
+
+// ETA : estimates how long the ingestion still runs, extrapolating from the rate bytes were read at so far.
+// The estimate is unknown (false) until some bytes were read, and zero once the ingestion is done.
+func (status Status) ETA(now time.Time) (time.Duration, bool) {
+	if status.Done {
+		return 0, true
+	}
+
+	elapsed := now.Sub(status.StartedAt)
+	if status.BytesRead <= 0 || status.TotalBytes <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+
+	remaining := status.TotalBytes - status.BytesRead
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return time.Duration(float64(elapsed) * float64(remaining) / float64(status.BytesRead)), true
+}
+
+// Ingest : builds an index from every line of the sources, reporting how far it went in progress.
+// Lines that cannot be parsed are logged as warnings and skipped.
+func Ingest(sources []config.Source, progress *Progress) (*index.Index, error) {
+	defer atomic.StoreInt32(&progress.done, 1)
+
+	for _, source := range sources {
+		info, err := os.Stat(source.Path)
+		if err != nil {
+			return nil, errors.New("Could not read source " + source.Path + " : " + err.Error())
+		}
+		atomic.AddInt64(&progress.totalBytes, info.Size())
+	}
+
+	builder := index.NewBuilder()
+	for _, source := range sources {
+		if err := ingestSource(source, builder, progress); err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Build()
+}
+
+func ingestSource(source config.Source, builder *index.Builder, progress *Progress) error {
+	format, err := source.Parser()
+	if err != nil {
+		return errors.New("Invalid source " + source.Path + " : " + err.Error())
+	}
+
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return errors.New("Could not read source " + source.Path + " : " + err.Error())
+	}
+	defer file.Close()
+
+	logger := logging.Component("ingestion").With(logging.Fields{"source": source.Path})
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		atomic.AddInt64(&progress.linesRead, 1)
+		atomic.AddInt64(&progress.bytesRead, int64(len(line)+1))
+
+		parsedQuery, parseError := format.Parse(line)
+		if parseError != nil {
+			logger.Warn("Could not parse line", logging.Fields{"line": lineNumber, "error": parseError})
+			atomic.AddInt64(&progress.linesRejected, 1)
+		} else {
+			builder.Add(parsedQuery)
+		}
+
+		if progress.observer != nil {
+			progress.observer(parseError == nil)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.New("Could not read source " + source.Path + " : " + err.Error())
+	}
+
+	return nil
+}
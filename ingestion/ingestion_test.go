@@ -0,0 +1,98 @@
+package ingestion
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/logging"
+)
+
+func writeSource(t *testing.T, name, content string) string {
+	directory, err := ioutil.TempDir("", "hn-queries")
+	assert.NoError(t, err, "Temporary directory should have been created")
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	path := filepath.Join(directory, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644), "Source should have been written")
+	return path
+}
+
+func Test_Ingest_ShouldIndexEverySource(t *testing.T) {
+	tsv := writeSource(t, "hn_logs.tsv", constant.CorrectLine+"\nnot a line\n")
+	jsonl := writeSource(t, "queries.jsonl", `{"time": "2015-08-01T00:03:43Z", "url": "algolia"}`+"\n")
+
+	progress := NewProgress()
+	index, err := Ingest([]config.Source{{Path: tsv, Format: "tsv"}, {Path: jsonl, Format: "jsonl"}}, progress)
+	assert.NoError(t, err, "Sources should have been ingested")
+	assert.Equal(t, 2, len(index.URLsToID), "Two urls should have been indexed")
+
+	status := progress.Status()
+	assert.Equal(t, int64(3), status.LinesRead, "Three lines should have been read")
+	assert.Equal(t, int64(2), status.LinesIndexed, "Two lines should have been indexed")
+	assert.Equal(t, int64(1), status.LinesRejected, "One line should have been rejected")
+	assert.Equal(t, status.TotalBytes, status.BytesRead, "Every byte should have been read")
+	assert.True(t, status.Done, "Ingestion should be done")
+}
+
+func Test_Ingest_ShouldLogRejectedLines(t *testing.T) {
+	tsv := writeSource(t, "hn_logs.tsv", constant.CorrectLine+"\nnot a line\n")
+	var buffer bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(&buffer, logging.Info))
+
+	Ingest([]config.Source{{Path: tsv, Format: "tsv"}}, NewProgress())
+
+	var logged map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &logged), "A rejected line should be logged as a JSON line")
+	assert.Equal(t, "warn", logged["level"], "A rejected line should be a warning")
+	assert.Equal(t, "ingestion", logged["component"], "The component should be logged")
+	assert.Equal(t, tsv, logged["source"], "The source should be logged")
+	assert.Equal(t, 2.0, logged["line"], "The number of the line should be logged")
+	assert.NotEmpty(t, logged["error"], "Why the line was rejected should be logged")
+}
+
+func Test_Ingest_MissingSource_ShouldFail(t *testing.T) {
+	progress := NewProgress()
+	_, err := Ingest([]config.Source{{Path: "/does/not/exist.tsv"}}, progress)
+	assert.Error(t, err, "A missing source should not be ingested")
+	assert.True(t, progress.Status().Done, "A failed ingestion should be done")
+}
+
+func Test_ETA_ShouldExtrapolateFromByteRate(t *testing.T) {
+	startedAt := time.Date(2021, 1, 17, 11, 0, 0, 0, time.UTC)
+	status := Status{BytesRead: 25, TotalBytes: 100, StartedAt: startedAt}
+
+	eta, known := status.ETA(startedAt.Add(time.Minute))
+	assert.True(t, known, "ETA should be known once bytes were read")
+	assert.Equal(t, 3*time.Minute, eta, "Three quarters of the bytes should take three more minutes")
+}
+
+func Test_ETA_ShouldBeUnknownBeforeReading(t *testing.T) {
+	status := Status{TotalBytes: 100, StartedAt: time.Now()}
+	_, known := status.ETA(time.Now().Add(time.Second))
+	assert.False(t, known, "ETA should be unknown until some bytes were read")
+
+	eta, known := Status{Done: true}.ETA(time.Now())
+	assert.True(t, known, "ETA of a finished ingestion should be known")
+	assert.Equal(t, time.Duration(0), eta, "A finished ingestion has nothing left to do")
+}
+
+func Test_Ingest_ShouldNotifyObserver(t *testing.T) {
+	tsv := writeSource(t, "hn_logs.tsv", constant.CorrectLine+"\nnot a line\n"+constant.CorrectLine+"\n")
+
+	observed := map[bool]int{}
+	progress := NewProgress()
+	progress.Observe(func(indexed bool) { observed[indexed]++ })
+	_, err := Ingest([]config.Source{{Path: tsv}}, progress)
+
+	assert.NoError(t, err, "Source should have been ingested")
+	assert.Equal(t, map[bool]int{true: 2, false: 1}, observed, "Every line should have been observed")
+}
@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level : how important a log line is. Lines below the level of a logger are not written.
+type Level int
+
+// Levels, from the least to the most important
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (level Level) String() string {
+	if level < Debug || level > Error {
+		return "unknown"
+	}
+
+	return levelNames[level]
+}
+
+// ParseLevel : the level of a name (debug, info, warn or error). An empty name is Info.
+func ParseLevel(name string) (Level, error) {
+	if name == "" {
+		return Info, nil
+	}
+
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(level), nil
+		}
+	}
+
+	return Info, errors.New("Unknown log level : " + name + ". Supported levels are " + strings.Join(levelNames, ", "))
+}
+
+// Fields : what a log line tells besides its time, level and message, e.g. component, request_id, latency, prefix, size
+type Fields map[string]interface{}
+
+// Logger : writes log lines as JSON objects, one per line : {"time": ..., "level": ..., "message": ..., <fields>}.
+// It is safe for concurrent use, and so are the loggers derived from it, which share its sink.
+type Logger struct {
+	sink   *sink
+	level  Level
+	fields Fields
+}
+
+// sink : where lines are written, one at a time
+type sink struct {
+	sync.Mutex
+	writer io.Writer
+}
+
+// New : a logger writing lines of level and above to writer
+func New(writer io.Writer, level Level) *Logger {
+	return &Logger{&sink{writer: writer}, level, Fields{}}
+}
+
+// With : a logger adding fields to every line, e.g. the component it logs for
+func (logger *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(logger.fields)+len(fields))
+	for name, value := range logger.fields {
+		merged[name] = value
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+
+	return &Logger{logger.sink, logger.level, merged}
+}
+
+// Enabled : whether lines of level are written
+func (logger *Logger) Enabled(level Level) bool {
+	return level >= logger.level
+}
+
+// Debug : writes a debug line. fields can be nil.
+func (logger *Logger) Debug(message string, fields Fields) {
+	logger.Log(Debug, message, fields)
+}
+
+// Info : writes an info line. fields can be nil.
+func (logger *Logger) Info(message string, fields Fields) {
+	logger.Log(Info, message, fields)
+}
+
+// Warn : writes a warn line. fields can be nil.
+func (logger *Logger) Warn(message string, fields Fields) {
+	logger.Log(Warn, message, fields)
+}
+
+// Error : writes an error line. fields can be nil.
+func (logger *Logger) Error(message string, fields Fields) {
+	logger.Log(Error, message, fields)
+}
+
+// Fatal : writes an error line, then exits the process
+func (logger *Logger) Fatal(message string, fields Fields) {
+	logger.Log(Error, message, fields)
+	os.Exit(1)
+}
+
+// Log : writes a line of level, when the logger is enabled for it.
+// Fields are written after the time, level and message, sorted by name. Errors are written as their message.
+func (logger *Logger) Log(level Level, message string, fields Fields) {
+	if !logger.Enabled(level) {
+		return
+	}
+
+	line := []byte(`{"time":`)
+	line = appendJSON(line, time.Now().UTC().Format(time.RFC3339Nano))
+	line = append(line, `,"level":`...)
+	line = appendJSON(line, level.String())
+	line = append(line, `,"message":`...)
+	line = appendJSON(line, message)
+
+	merged := logger.With(fields).fields
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		if name != "time" && name != "level" && name != "message" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := merged[name]
+		if err, isError := value.(error); isError {
+			value = err.Error()
+		}
+
+		line = append(line, ',')
+		line = appendJSON(line, name)
+		line = append(line, ':')
+		line = appendJSON(line, value)
+	}
+	line = append(line, "}\n"...)
+
+	logger.sink.Lock()
+	logger.sink.writer.Write(line)
+	logger.sink.Unlock()
+}
+
+func appendJSON(line []byte, value interface{}) []byte {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(err.Error())
+	}
+
+	return append(line, encoded...)
+}
+
+// Open : the sink named by output : stdout, stderr, or else the path of a file, which lines are appended to. Empty is stdout.
+func Open(output string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.New("Could not open log output : " + err.Error())
+	}
+
+	return file, nil
+}
+
+var (
+	defaultMutex  sync.RWMutex
+	defaultLogger = New(os.Stdout, Info)
+)
+
+// Default : the logger of the process, writing info lines and above to the standard output unless SetDefault replaced it
+func Default() *Logger {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+
+	return defaultLogger
+}
+
+// SetDefault : replaces the logger of the process, e.g. once the configuration is read
+func SetDefault(logger *Logger) {
+	defaultMutex.Lock()
+	defaultLogger = logger
+	defaultMutex.Unlock()
+}
+
+// Component : the logger of the process, adding the component it logs for to every line
+func Component(name string) *Logger {
+	return Default().With(Fields{"component": name})
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lines(buffer *bytes.Buffer) []map[string]interface{} {
+	decoded := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var fields map[string]interface{}
+		json.Unmarshal([]byte(line), &fields)
+		decoded = append(decoded, fields)
+	}
+
+	return decoded
+}
+
+func Test_Logger_ShouldWriteJSONLines(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := New(&buffer, Info).With(Fields{"component": "ingestion"})
+	logger.Info("Indexing : OK", Fields{"lines": 42, "error": errors.New("oops")})
+
+	written := lines(&buffer)
+	assert.Equal(t, 1, len(written), "One line should be written")
+	assert.Equal(t, "info", written[0]["level"], "The level should be written")
+	assert.Equal(t, "Indexing : OK", written[0]["message"], "The message should be written")
+	assert.Equal(t, "ingestion", written[0]["component"], "The fields of the logger should be written")
+	assert.Equal(t, 42.0, written[0]["lines"], "The fields of the line should be written")
+	assert.Equal(t, "oops", written[0]["error"], "Errors should be written as their message")
+	assert.NotEmpty(t, written[0]["time"], "The time should be written")
+	assert.True(t, strings.HasPrefix(buffer.String(), `{"time":`), "The time should come first")
+}
+
+func Test_Logger_ShouldSkipLinesBelowLevel(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := New(&buffer, Warn)
+	logger.Debug("debug", nil)
+	logger.Info("info", nil)
+	logger.Warn("warn", nil)
+	logger.Error("error", nil)
+
+	written := lines(&buffer)
+	assert.Equal(t, 2, len(written), "Only lines of the level and above should be written")
+	assert.Equal(t, "warn", written[0]["level"], "Warn lines should be written")
+	assert.Equal(t, "error", written[1]["level"], "Error lines should be written")
+}
+
+func Test_Logger_With_ShouldNotChangeParent(t *testing.T) {
+	var buffer bytes.Buffer
+	parent := New(&buffer, Info)
+	parent.With(Fields{"component": "http"})
+	parent.Info("message", nil)
+
+	_, found := lines(&buffer)[0]["component"]
+	assert.False(t, found, "A derived logger should not add its fields to its parent")
+}
+
+func Test_ParseLevel_ShouldKnowLevels(t *testing.T) {
+	for _, level := range []Level{Debug, Info, Warn, Error} {
+		parsed, err := ParseLevel(strings.ToUpper(level.String()))
+		assert.NoError(t, err, "Levels should be parsed whatever their case : "+level.String())
+		assert.Equal(t, level, parsed, "Levels should be parsed : "+level.String())
+	}
+
+	level, err := ParseLevel("")
+	assert.NoError(t, err, "An empty level should be parsed")
+	assert.Equal(t, Info, level, "An empty level should be info")
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err, "An unknown level should not be parsed")
+}
+
+func Test_Open_ShouldAppendToFile(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "hn-queries")
+	defer os.RemoveAll(directory)
+	path := filepath.Join(directory, "hnq.log")
+
+	for i := 0; i < 2; i++ {
+		writer, err := Open(path)
+		assert.NoError(t, err, "A file should be opened")
+		New(writer, Info).Info("message", nil)
+		writer.(*os.File).Close()
+	}
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 2, strings.Count(string(content), "\n"), "Lines should be appended to the file")
+
+	writer, _ := Open("stderr")
+	assert.Equal(t, os.Stderr, writer, "stderr should be the standard error")
+}
@@ -1,63 +1,266 @@
 package main
 
 import (
-	"bufio"
-	"log"
+	"context"
+	"flag"
+	"io"
+	"net"
+	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/thomaspepio/hn-queries/config"
 	"github.com/thomaspepio/hn-queries/endpoint"
-	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/ingestion"
+	"github.com/thomaspepio/hn-queries/logging"
+	"github.com/thomaspepio/hn-queries/rpc"
+	"google.golang.org/grpc"
 
 	"github.com/thomaspepio/hn-queries/index"
 )
 
 func main() {
-	index := ingestHnLogs()
-	startEndpoints(index)
+	configPath := flag.String("config", "", "path to a JSON configuration file (indexes ./hn_logs.tsv when omitted)")
+	flag.Parse()
+
+	configuration, err := loadConfig(*configPath)
+	if err != nil {
+		logger().Fatal("Could not load configuration", logging.Fields{"error": err})
+	}
+
+	if err := setUpLogging(configuration.Log); err != nil {
+		logger().Fatal("Could not set up logging", logging.Fields{"error": err})
+	}
+
+	startEndpoints(configuration, *configPath)
 }
 
-func ingestHnLogs() *index.Index {
-	now := time.Now()
-	os.Stdout.WriteString(now.UTC().String() + " - Start indexing...\n")
-	index := index.EmptyIndex()
+// The sink the logs of the process are written to, closed once logging is set up again
+var logOutput io.Writer = os.Stdout
 
-	file, err := os.Open("./hn_logs.tsv")
+// setUpLogging : writes the logs of the process as configured. gin's debug output is turned off unless GIN_MODE asks for it,
+// as it is not JSON. The former log file, if any, is closed.
+func setUpLogging(settings config.Log) error {
+	level, err := logging.ParseLevel(settings.Level)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	nbIndexed := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		parsedQuery, parseError := parser.ParseHNQuery(line)
+	writer, err := logging.Open(settings.Output)
+	if err != nil {
+		return err
+	}
 
-		if parseError != nil {
-			os.Stdout.WriteString(parseError.Error() + "\n")
-		} else {
-			index.Add(parsedQuery)
-			nbIndexed++
+	logging.SetDefault(logging.New(writer, level))
+	if closer, isFile := logOutput.(io.Closer); isFile && logOutput != os.Stdout && logOutput != os.Stderr && logOutput != writer {
+		closer.Close()
+	}
+	logOutput = writer
+
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	return nil
+}
+
+func loadConfig(configPath string) (*config.Config, error) {
+	if configPath == "" {
+		return config.Default(), nil
+	}
+
+	return config.Load(configPath)
+}
+
+// startServer : sets up the endpoints, and loads the index in the background : from its snapshot when asked to and there is one,
+// from the sources otherwise. The process exits when the index cannot be loaded.
+func startServer(configuration *config.Config) *endpoint.Server {
+	if configuration.LoadSnapshot && configuration.SnapshotPath != "" {
+		if file, err := os.Open(configuration.SnapshotPath); err == nil {
+			server := endpoint.NewStartingServer(configuration, nil)
+			go func() {
+				defer file.Close()
+				server.Ready(readSnapshot(file, configuration.SnapshotPath))
+			}()
+			return server
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+	progress := ingestion.NewProgress()
+	server := endpoint.NewStartingServer(configuration, progress)
+	go func() {
+		server.Ready(ingestHnLogs(configuration, progress))
+	}()
+	return server
+}
+
+func readSnapshot(file *os.File, path string) *index.Index {
+	logger := logging.Component("ingestion").With(logging.Fields{"snapshot": path})
+	logger.Info("Reading index snapshot", nil)
+
+	start := time.Now()
+	index, err := index.ReadSnapshot(file)
+	if err != nil {
+		logger.Fatal("Could not read index snapshot", logging.Fields{"error": err})
 	}
 
-	now = time.Now()
-	os.Stdout.WriteString(now.UTC().String() + " - Indexing : OK\n")
-	os.Stdout.WriteString(now.UTC().String() + " - " + strconv.Itoa(nbIndexed) + " log lines indexed\n")
+	logger.Info("Index snapshot read", logging.Fields{"latency": time.Since(start).Seconds(), "queries": index.Sequence})
 	return index
 }
 
-func startEndpoints(index *index.Index) {
-	if index == nil {
-		panic("Could not start server : index is nil")
+func ingestHnLogs(configuration *config.Config, progress *ingestion.Progress) *index.Index {
+	logger := logging.Component("ingestion")
+	logger.Info("Indexing sources", logging.Fields{"sources": len(configuration.Sources)})
+
+	index, err := ingestion.Ingest(configuration.Sources, progress)
+	if err != nil {
+		logger.Fatal("Could not index sources", logging.Fields{"error": err})
+	}
+
+	status := progress.Status()
+	logger.Info("Sources indexed", logging.Fields{
+		"latency":        time.Since(status.StartedAt).Seconds(),
+		"lines_indexed":  status.LinesIndexed,
+		"lines_rejected": status.LinesRejected,
+	})
+	return index
+}
+
+// startEndpoints : serves the endpoints until SIGINT or SIGTERM is received, then drains in-flight requests and calls
+// and writes the index snapshot. SIGHUP reloads the configuration, logging included : the last configuration loaded tells
+// how long to drain and where to write the snapshot.
+// The endpoints are served right away : /readyz tells when the index is loaded.
+func startEndpoints(configuration *config.Config, configPath string) {
+	server := startServer(configuration)
+	httpServer := &http.Server{Addr: configuration.Address, Handler: server.Handler(), ReadTimeout: time.Duration(configuration.ReadTimeout)}
+	httpServer.RegisterOnShutdown(server.CloseStreams)
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger().Fatal("Could not serve the endpoints", logging.Fields{"error": err})
+		}
+	}()
+	logger().Info("Listening", logging.Fields{"address": configuration.Address})
+
+	grpcServer := startGRPC(server, configuration.GRPCAddress)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for received := range signals {
+		if received != syscall.SIGHUP {
+			logger().Info("Shutting down", logging.Fields{"signal": received.String()})
+			break
+		}
+
+		reloaded, err := loadConfig(configPath)
+		if err != nil {
+			logger().Error("Could not reload configuration, keeping the current one", logging.Fields{"error": err})
+			continue
+		}
+		if err := setUpLogging(reloaded.Log); err != nil {
+			logger().Error("Could not set up logging again, keeping the current one", logging.Fields{"error": err})
+		}
+		server.Reload(reloaded)
+		configuration = reloaded
+		logger().Info("Configuration reloaded", nil)
+	}
+	signal.Stop(signals)
+
+	// Requests and calls are drained at the same time, so that neither waits for the other
+	drainContext, cancel := context.WithTimeout(context.Background(), time.Duration(configuration.DrainTimeout))
+	defer cancel()
+	var drained sync.WaitGroup
+	drained.Add(1)
+	go func() {
+		defer drained.Done()
+		if err := httpServer.Shutdown(drainContext); err != nil {
+			logger().Warn("In-flight requests could not be drained in time", logging.Fields{"error": err})
+		}
+	}()
+	if grpcServer != nil {
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			stopGRPC(grpcServer, drainContext)
+		}()
+	}
+	drained.Wait()
+
+	if configuration.SnapshotPath != "" {
+		if err := writeSnapshot(server, configuration.SnapshotPath); err != nil {
+			logger().Error("Could not write index snapshot", logging.Fields{"snapshot": configuration.SnapshotPath, "error": err})
+		} else {
+			logger().Info("Index snapshot written", logging.Fields{"snapshot": configuration.SnapshotPath})
+		}
+	}
+}
+
+// startGRPC : serves the gRPC service on address, from the same index as the endpoints. Nothing is served when address is empty.
+func startGRPC(server *endpoint.Server, address string) *grpc.Server {
+	if address == "" {
+		return nil
+	}
+
+	logger := logging.Component("grpc")
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		logger.Fatal("Could not listen", logging.Fields{"address": address, "error": err})
+	}
+
+	grpcServer := rpc.NewServer(server)
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			logger.Fatal("Could not serve the gRPC service", logging.Fields{"error": err})
+		}
+	}()
+	logger.Info("Listening", logging.Fields{"address": address})
+
+	return grpcServer
+}
+
+// stopGRPC : waits for in-flight calls until drainContext is done, then closes every connection
+func stopGRPC(grpcServer *grpc.Server, drainContext context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-drainContext.Done():
+		logging.Component("grpc").Warn("In-flight calls could not be drained in time", nil)
+		grpcServer.Stop()
 	}
+}
+
+// writeSnapshot : writes the snapshot next to its destination first, so that a failed write never corrupts the former snapshot
+func writeSnapshot(server *endpoint.Server, path string) error {
+	temporaryPath := path + ".tmp"
+	file, err := os.Create(temporaryPath)
+	if err != nil {
+		return err
+	}
+
+	if err := server.WriteSnapshot(file); err != nil {
+		file.Close()
+		os.Remove(temporaryPath)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(temporaryPath)
+		return err
+	}
+
+	return os.Rename(temporaryPath, path)
+}
 
-	router := endpoint.Router(index)
-	router.Run(":8080")
+// logger : the logger of the process, as set up from the configuration
+func logger() *logging.Logger {
+	return logging.Component("main")
 }
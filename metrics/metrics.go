@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/thomaspepio/hn-queries/index"
+)
+
+const namespace = "hnq"
+
+// Metrics : the series the service exposes, in a registry of their own so that several servers can live in the same process
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	lines           *prometheus.CounterVec
+	cacheLookups    *prometheus.CounterVec
+}
+
+// New : registers the series, along with the Go runtime and process ones
+func New() *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by endpoint, granularity of the date prefix and status code.",
+		}, []string{"endpoint", "granularity", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time spent serving HTTP requests, by endpoint, granularity of the date prefix and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint", "granularity", "code"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Time spent searching the index, by query (count, popular) and granularity.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, []string{"query", "granularity"}),
+		lines: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ingested_lines_total",
+			Help:      "Lines read from the sources or the ingest endpoint, by status (indexed, rejected).",
+		}, []string{"status"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Lookups of the popular queries cache, by result (hit, miss).",
+		}, []string{"result"}),
+	}
+
+	metrics.registry.MustRegister(
+		metrics.requests,
+		metrics.requestDuration,
+		metrics.queryDuration,
+		metrics.lines,
+		metrics.cacheLookups,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return metrics
+}
+
+// Handler : serves the series in the Prometheus text format
+func (metrics *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest : records an HTTP request. granularity is empty for endpoints taking no date prefix.
+func (metrics *Metrics) ObserveRequest(endpoint, granularity string, code int, duration time.Duration) {
+	labels := prometheus.Labels{"endpoint": endpoint, "granularity": granularity, "code": strconv.Itoa(code)}
+	metrics.requests.With(labels).Inc()
+	metrics.requestDuration.With(labels).Observe(duration.Seconds())
+}
+
+// ObserveQuery : records a search of the index
+func (metrics *Metrics) ObserveQuery(query, granularity string, duration time.Duration) {
+	metrics.queryDuration.WithLabelValues(query, granularity).Observe(duration.Seconds())
+}
+
+// ObserveLine : records an ingested line, whether it was indexed or rejected
+func (metrics *Metrics) ObserveLine(indexed bool) {
+	metrics.ObserveLines(indexed, 1)
+}
+
+// ObserveLines : records several ingested lines sharing the same status
+func (metrics *Metrics) ObserveLines(indexed bool, count int) {
+	if indexed {
+		metrics.lines.WithLabelValues("indexed").Add(float64(count))
+	} else {
+		metrics.lines.WithLabelValues("rejected").Add(float64(count))
+	}
+}
+
+// ObserveCache : records a lookup of the popular queries cache, whether it found the queries or not
+func (metrics *Metrics) ObserveCache(hit bool) {
+	if hit {
+		metrics.cacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		metrics.cacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// WatchIndex : exposes the size of the index as gauges. current is called on every scrape,
+// and returns the index along with a function releasing it, or a nil index while there is none.
+func (metrics *Metrics) WatchIndex(current func() (*index.Index, func())) {
+	gauge := func(name, help string, measure func(*index.Index) float64) prometheus.GaugeFunc {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, func() float64 {
+			index, release := current()
+			defer release()
+
+			if index == nil {
+				return 0
+			}
+			return measure(index)
+		})
+	}
+
+	metrics.registry.MustRegister(
+		gauge("index_nodes", "Nodes in the index tree, one per indexed year, month, day, hour and minute.", func(index *index.Index) float64 {
+			return float64(index.Tree.Count() - 1) // less the sentinel root
+		}),
+		gauge("index_urls", "Distinct URLs in the index.", func(index *index.Index) float64 {
+			return float64(len(index.URLsToID))
+		}),
+		gauge("index_queries", "Queries added to the index.", func(index *index.Index) float64 {
+			return float64(index.Sequence)
+		}),
+		gauge("index_version", "Version of the index, which changes every time the index does.", func(index *index.Index) float64 {
+			return float64(index.Version)
+		}),
+		gauge("index_dimensions", "Attribute values the index can be filtered on.", func(index *index.Index) float64 {
+			values := 0
+			for _, dimension := range index.Dimensions {
+				values += len(dimension)
+			}
+			return float64(values)
+		}),
+	)
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/parser"
+)
+
+func Test_ObserveLines_ShouldCountByStatus(t *testing.T) {
+	metrics := New()
+	metrics.ObserveLine(true)
+	metrics.ObserveLines(true, 2)
+	metrics.ObserveLine(false)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(metrics.lines.WithLabelValues("indexed")), "Three lines should have been indexed")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.lines.WithLabelValues("rejected")), "One line should have been rejected")
+}
+
+func Test_ObserveCache_ShouldCountByResult(t *testing.T) {
+	metrics := New()
+	metrics.ObserveCache(true)
+	metrics.ObserveCache(false)
+	metrics.ObserveCache(false)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.cacheLookups.WithLabelValues("hit")), "One lookup should have hit")
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.cacheLookups.WithLabelValues("miss")), "Two lookups should have missed")
+}
+
+func Test_ObserveRequest_ShouldCountByLabels(t *testing.T) {
+	metrics := New()
+	metrics.ObserveRequest("/1/queries/count/:datePrefix", "year", http.StatusOK, time.Millisecond)
+	metrics.ObserveRequest("/1/queries/count/:datePrefix", "year", http.StatusOK, time.Millisecond)
+	metrics.ObserveRequest("/1/queries/count/:datePrefix", "invalid", http.StatusBadRequest, time.Millisecond)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.requests.WithLabelValues("/1/queries/count/:datePrefix", "year", "200")), "Two successful requests should have been counted")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("/1/queries/count/:datePrefix", "invalid", "400")), "One failed request should have been counted")
+}
+
+func Test_WatchIndex_ShouldExposeIndexSize(t *testing.T) {
+	watched := index.EmptyIndex()
+	parsedQuery, _ := parser.ParseHNQuery("2015-08-01 00:03:43\thttp://an-url")
+	watched.Add(parsedQuery)
+	watched.Add(parsedQuery)
+
+	metrics := New()
+	metrics.WatchIndex(func() (*index.Index, func()) { return watched, func() {} })
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Contains(t, body, "hnq_index_nodes 5", "A query should be indexed under five keys")
+	assert.Contains(t, body, "hnq_index_urls 1", "One distinct URL should have been indexed")
+	assert.Contains(t, body, "hnq_index_queries 2", "Two queries should have been indexed")
+	assert.Contains(t, body, "hnq_index_version "+strconv.FormatUint(watched.Version, 10), "The version of the index should be exposed")
+}
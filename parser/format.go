@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/thomaspepio/hn-queries/constant"
+)
+
+// A Format parses the lines of an input file into queries
+type Format interface {
+	Parse(line string) (*ParsedQuery, error)
+}
+
+// TSVFormat : <date><tab><url> lines, the format of HN logs.
+// Extra columns are read as attributes, AttributeColumns mapping attribute names to columns (starting from 0).
+type TSVFormat struct {
+	Layouts          []string
+	AttributeColumns map[string]int
+}
+
+// CSVFormat : comma separated lines, the date and the url being read from the given columns (starting from 0)
+// Extra columns are read as attributes, AttributeColumns mapping attribute names to columns.
+type CSVFormat struct {
+	TimeColumn       int
+	URLColumn        int
+	Layouts          []string
+	AttributeColumns map[string]int
+}
+
+// JSONLFormat : one JSON object per line, the date and the url being read from the given fields.
+// Fields are paths in the object, nested fields being separated by dots (e.g. "request.query").
+// Attributes are read from AttributeFields, mapping attribute names to fields.
+type JSONLFormat struct {
+	TimeField       string
+	URLField        string
+	Layouts         []string
+	AttributeFields map[string]string
+}
+
+// CLFFormat : Common and Combined Log Format lines, as written by Apache or Nginx
+// e.g. : 127.0.0.1 - - [01/Aug/2015:00:03:43 +0000] "GET /search?q=algolia HTTP/1.1" 200 512 "-" "curl/7.64.1"
+// The query is read from the QueryParam parameter of the request path, or is the whole request path when QueryParam is empty.
+// Attributes are read from AttributeFields, mapping attribute names to one of the CLFFields.
+type CLFFormat struct {
+	QueryParam      string
+	AttributeFields map[string]string
+}
+
+// CLFFields : fields of a log line that can be read as attributes
+var CLFFields = []string{"ip", "user", "referrer", "userAgent"}
+
+var regexpCLF = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "([^"]*)"(?: \S+ \S+ "([^"]*)" "([^"]*)")?`)
+
+// FormatNames : the names under which formats can be selected
+var FormatNames = []string{"tsv", "csv", "jsonl", "clf"}
+
+// FormatFromName : the format with the given name, set up with its default options
+func FormatFromName(name string) (Format, error) {
+	switch name {
+	case "", "tsv":
+		return &TSVFormat{DefaultLayouts, nil}, nil
+	case "csv":
+		return &CSVFormat{0, 1, DefaultLayouts, nil}, nil
+	case "jsonl":
+		return &JSONLFormat{"time", "url", DefaultLayouts, nil}, nil
+	case "clf", "combined":
+		return &CLFFormat{"", nil}, nil
+	}
+
+	return nil, errors.New("Unknown input format : " + name + ". Supported formats are " + strings.Join(FormatNames, ", "))
+}
+
+// Parse : parses a <date><tab><url> line, followed by attributes columns if any
+func (format *TSVFormat) Parse(line string) (*ParsedQuery, error) {
+	if len(format.AttributeColumns) == 0 {
+		return ParseHNQueryWithLayouts(line, layoutsOrDefault(format.Layouts))
+	}
+
+	columns := strings.Split(line, constant.Tab)
+	return fromColumns(line, columns, 0, 1, format.AttributeColumns, format.Layouts)
+}
+
+// Parse : parses a comma separated line
+func (format *CSVFormat) Parse(line string) (*ParsedQuery, error) {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.FieldsPerRecord = -1
+
+	columns, csvErr := reader.Read()
+	if csvErr != nil {
+		return nil, errors.New("Unable to parse line : " + line)
+	}
+
+	return fromColumns(line, columns, format.TimeColumn, format.URLColumn, format.AttributeColumns, format.Layouts)
+}
+
+// Parse : parses a JSON object
+func (format *JSONLFormat) Parse(line string) (*ParsedQuery, error) {
+	var object map[string]interface{}
+	if jsonErr := json.Unmarshal([]byte(line), &object); jsonErr != nil {
+		return nil, errors.New("Unable to parse line : " + line)
+	}
+
+	date, dateFound := stringField(object, format.TimeField)
+	if !dateFound {
+		return nil, errors.New("Unable to find date field " + format.TimeField + " in : " + line)
+	}
+
+	url, urlFound := stringField(object, format.URLField)
+	if !urlFound {
+		return nil, errors.New("Unable to find url field " + format.URLField + " in : " + line)
+	}
+
+	time, timeErr := ParseTime(date, layoutsOrDefault(format.Layouts))
+	if timeErr != nil {
+		return nil, timeErr
+	}
+
+	var attributes map[string]string
+	for name, field := range format.AttributeFields {
+		if value, found := stringField(object, field); found {
+			attributes = withAttribute(attributes, name, value)
+		}
+	}
+
+	return &ParsedQuery{time, url, attributes}, nil
+}
+
+// Parse : parses a Common or Combined Log Format line
+func (format *CLFFormat) Parse(line string) (*ParsedQuery, error) {
+	matches := regexpCLF.FindStringSubmatch(line)
+	if matches == nil {
+		return nil, errors.New("Unable to parse line : " + line)
+	}
+
+	time, timeErr := ParseTime(matches[3], []string{constant.CLFDateFormat})
+	if timeErr != nil {
+		return nil, timeErr
+	}
+
+	request := strings.Fields(matches[4])
+	if len(request) < 2 {
+		return nil, errors.New("Unable to parse request from : " + matches[4])
+	}
+
+	fields := map[string]string{"ip": matches[1], "user": matches[2], "referrer": matches[5], "userAgent": matches[6]}
+	var attributes map[string]string
+	for name, field := range format.AttributeFields {
+		if value := fields[field]; value != "" && value != constant.Dash {
+			attributes = withAttribute(attributes, name, value)
+		}
+	}
+
+	path := request[1]
+	if format.QueryParam == "" {
+		return &ParsedQuery{time, path, attributes}, nil
+	}
+
+	requestURL, urlErr := url.Parse(path)
+	if urlErr != nil {
+		return nil, errors.New("Unable to parse request path : " + path)
+	}
+
+	query := requestURL.Query().Get(format.QueryParam)
+	if query == "" {
+		return nil, errors.New("Unable to find query parameter " + format.QueryParam + " in : " + path)
+	}
+
+	return &ParsedQuery{time, query, attributes}, nil
+}
+
+// fromColumns : makes a query from the columns of a line, attributes columns being optional
+func fromColumns(line string, columns []string, timeColumn, urlColumn int, attributeColumns map[string]int, layouts []string) (*ParsedQuery, error) {
+	if !inBounds(timeColumn, columns) || !inBounds(urlColumn, columns) {
+		return nil, errors.New("Unable to parse line : " + line)
+	}
+
+	time, timeErr := ParseTime(columns[timeColumn], layoutsOrDefault(layouts))
+	if timeErr != nil {
+		return nil, timeErr
+	}
+
+	var attributes map[string]string
+	for name, column := range attributeColumns {
+		if inBounds(column, columns) && columns[column] != "" {
+			attributes = withAttribute(attributes, name, columns[column])
+		}
+	}
+
+	return &ParsedQuery{time, columns[urlColumn], attributes}, nil
+}
+
+func withAttribute(attributes map[string]string, name, value string) map[string]string {
+	if attributes == nil {
+		attributes = make(map[string]string)
+	}
+
+	attributes[name] = value
+	return attributes
+}
+
+// stringField : walks a dotted path in a JSON object, and returns the string found at its end
+func stringField(object map[string]interface{}, path string) (string, bool) {
+	var value interface{} = object
+	for _, field := range strings.Split(path, ".") {
+		nested, isObject := value.(map[string]interface{})
+		if !isObject {
+			return "", false
+		}
+
+		var found bool
+		value, found = nested[field]
+		if !found {
+			return "", false
+		}
+	}
+
+	str, isString := value.(string)
+	return str, isString
+}
+
+func inBounds(column int, columns []string) bool {
+	return column >= 0 && column < len(columns)
+}
+
+func layoutsOrDefault(layouts []string) []string {
+	if len(layouts) == 0 {
+		return DefaultLayouts
+	}
+
+	return layouts
+}
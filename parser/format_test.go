@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/constant"
+)
+
+func expectedQuery(url string) ParsedQuery {
+	timeParsed, _ := time.Parse(constant.DateFormat, constant.DateAsString)
+	return ParsedQuery{timeParsed, url, nil}
+}
+
+func Test_FormatFromName_ShouldKnowEveryFormat(t *testing.T) {
+	for _, name := range FormatNames {
+		format, err := FormatFromName(name)
+		assert.NoError(t, err, name+" should be a known format")
+		assert.NotNil(t, format, name+" should be a known format")
+	}
+
+	_, err := FormatFromName("xml")
+	assert.Error(t, err, "xml is not a supported format")
+}
+
+func Test_TSVFormat_ShouldParseHNLines(t *testing.T) {
+	format, _ := FormatFromName("tsv")
+	parsedQuery, err := format.Parse(constant.CorrectLine)
+	assert.NoError(t, err, "A valid HN line should be parsed")
+	assert.Equal(t, expectedQuery(constant.URLAsString), *parsedQuery, "A valid HN line should be parsed")
+}
+
+func Test_CSVFormat_ShouldParseLines(t *testing.T) {
+	format, _ := FormatFromName("csv")
+	parsedQuery, err := format.Parse(constant.DateAsString + `,"hello, world"`)
+	assert.NoError(t, err, "A valid CSV line should be parsed")
+	assert.Equal(t, expectedQuery("hello, world"), *parsedQuery, "Quoted columns should be unquoted")
+
+	format = &CSVFormat{TimeColumn: 2, URLColumn: 0}
+	parsedQuery, err = format.Parse("algolia,fr,2015-08-01T00:03:43Z")
+	assert.NoError(t, err, "Columns should be configurable")
+	assert.Equal(t, expectedQuery("algolia"), *parsedQuery, "Columns should be configurable")
+}
+
+func Test_CSVFormat_ShouldFail(t *testing.T) {
+	format, _ := FormatFromName("csv")
+
+	_, err := format.Parse(constant.DateAsString)
+	assert.Error(t, err, "A line without url column should not be parsed")
+
+	_, err = format.Parse("not-a-date,algolia")
+	assert.Error(t, err, "A line with an invalid date should not be parsed")
+
+	_, err = (&CSVFormat{TimeColumn: -1}).Parse(constant.DateAsString + ",algolia")
+	assert.Error(t, err, "A negative column should not be read")
+}
+
+func Test_JSONLFormat_ShouldParseLines(t *testing.T) {
+	format, _ := FormatFromName("jsonl")
+	parsedQuery, err := format.Parse(`{"time": "2015-08-01T00:03:43Z", "url": "algolia"}`)
+	assert.NoError(t, err, "A valid JSON line should be parsed")
+	assert.Equal(t, expectedQuery("algolia"), *parsedQuery, "A valid JSON line should be parsed")
+
+	format = &JSONLFormat{TimeField: "timestamp", URLField: "request.query"}
+	parsedQuery, err = format.Parse(`{"timestamp": "2015-08-01 00:03:43", "request": {"query": "algolia", "page": 2}}`)
+	assert.NoError(t, err, "Nested fields should be read")
+	assert.Equal(t, expectedQuery("algolia"), *parsedQuery, "Nested fields should be read")
+}
+
+func Test_JSONLFormat_ShouldFail(t *testing.T) {
+	format := &JSONLFormat{TimeField: "time", URLField: "request.query"}
+
+	_, err := format.Parse(`not json`)
+	assert.Error(t, err, "A line that is not JSON should not be parsed")
+
+	_, err = format.Parse(`{"url": "algolia"}`)
+	assert.Error(t, err, "A line without date should not be parsed")
+
+	_, err = format.Parse(`{"time": "2015-08-01 00:03:43", "request": "algolia"}`)
+	assert.Error(t, err, "A field path going through a string should not be followed")
+
+	_, err = format.Parse(`{"time": "2015-08-01 00:03:43", "request": {"query": 42}}`)
+	assert.Error(t, err, "A url that is not a string should not be parsed")
+}
+
+func Test_CLFFormat_ShouldParseCommonAndCombinedLines(t *testing.T) {
+	common := `127.0.0.1 - frank [01/Aug/2015:02:03:43 +0200] "GET /search?q=algolia&page=2 HTTP/1.1" 200 2326`
+	combined := common + ` "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+
+	for _, line := range []string{common, combined} {
+		format, _ := FormatFromName("clf")
+		parsedQuery, err := format.Parse(line)
+		assert.NoError(t, err, "A valid log line should be parsed")
+		assert.Equal(t, expectedQuery("/search?q=algolia&page=2"), *parsedQuery, "The whole request path should be the query by default")
+
+		format = &CLFFormat{QueryParam: "q"}
+		parsedQuery, err = format.Parse(line)
+		assert.NoError(t, err, "A valid log line should be parsed")
+		assert.Equal(t, expectedQuery("algolia"), *parsedQuery, "The query should be read from the request parameter")
+	}
+}
+
+func Test_CLFFormat_ShouldFail(t *testing.T) {
+	format := &CLFFormat{QueryParam: "q"}
+
+	_, err := format.Parse("absolutely not a log line")
+	assert.Error(t, err, "An invalid line should not be parsed")
+
+	_, err = format.Parse(`127.0.0.1 - - [2015-08-01 00:03:43] "GET /search?q=algolia HTTP/1.1" 200 2326`)
+	assert.Error(t, err, "A line with an invalid date should not be parsed")
+
+	_, err = format.Parse(`127.0.0.1 - - [01/Aug/2015:00:03:43 +0000] "GET /search?page=2 HTTP/1.1" 200 2326`)
+	assert.Error(t, err, "A request without query parameter should not be parsed")
+
+	_, err = format.Parse(`127.0.0.1 - - [01/Aug/2015:00:03:43 +0000] "-" 400 0`)
+	assert.Error(t, err, "A line without request should not be parsed")
+}
+
+func Test_TSVFormat_ShouldReadAttributes(t *testing.T) {
+	format := &TSVFormat{AttributeColumns: map[string]int{"country": 2, "user": 3, "referrer": 5}}
+	parsedQuery, err := format.Parse(constant.CorrectLine + constant.Tab + "FR" + constant.Tab + "" + constant.Tab + "ignored")
+	assert.NoError(t, err, "A HN line with extra columns should be parsed")
+	assert.Equal(t, map[string]string{"country": "FR"}, parsedQuery.Attributes, "Only non empty attributes columns should be read")
+
+	_, err = format.Parse(constant.DateAsString)
+	assert.Error(t, err, "A line without url column should not be parsed")
+}
+
+func Test_CSVFormat_ShouldReadAttributes(t *testing.T) {
+	format := &CSVFormat{TimeColumn: 0, URLColumn: 1, AttributeColumns: map[string]int{"country": 2}}
+	parsedQuery, err := format.Parse(constant.DateAsString + ",algolia,FR")
+	assert.NoError(t, err, "A CSV line with extra columns should be parsed")
+	assert.Equal(t, map[string]string{"country": "FR"}, parsedQuery.Attributes, "Attributes columns should be read")
+}
+
+func Test_JSONLFormat_ShouldReadAttributes(t *testing.T) {
+	format := &JSONLFormat{TimeField: "time", URLField: "url", AttributeFields: map[string]string{"country": "geo.country", "user": "user"}}
+	parsedQuery, err := format.Parse(`{"time": "2015-08-01T00:03:43Z", "url": "algolia", "geo": {"country": "FR"}}`)
+	assert.NoError(t, err, "A JSON line with attributes should be parsed")
+	assert.Equal(t, map[string]string{"country": "FR"}, parsedQuery.Attributes, "Only the attributes present should be read")
+}
+
+func Test_CLFFormat_ShouldReadAttributes(t *testing.T) {
+	format := &CLFFormat{QueryParam: "q", AttributeFields: map[string]string{"from": "referrer", "user": "user", "ip": "ip", "agent": "userAgent"}}
+
+	parsedQuery, err := format.Parse(`127.0.0.1 - frank [01/Aug/2015:00:03:43 +0000] "GET /search?q=algolia HTTP/1.1" 200 2326 "http://hn.algolia.com/" "curl/7.64.1"`)
+	assert.NoError(t, err, "A combined log line should be parsed")
+	assert.Equal(t, map[string]string{"from": "http://hn.algolia.com/", "user": "frank", "ip": "127.0.0.1", "agent": "curl/7.64.1"}, parsedQuery.Attributes, "Attributes should be read")
+
+	parsedQuery, err = format.Parse(`127.0.0.1 - - [01/Aug/2015:00:03:43 +0000] "GET /search?q=algolia HTTP/1.1" 200 2326`)
+	assert.NoError(t, err, "A common log line should be parsed")
+	assert.Equal(t, map[string]string{"ip": "127.0.0.1"}, parsedQuery.Attributes, "Missing fields should not be read")
+}
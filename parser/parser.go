@@ -9,14 +9,27 @@ import (
 )
 
 // A ParsedQuery is a line parsed from the input file
+// Attributes holds the extra dimensions of the query (e.g. user, country, referrer), it is nil when the line has none.
 type ParsedQuery struct {
-	Time time.Time
-	URL  string
+	Time       time.Time
+	URL        string
+	Attributes map[string]string
 }
 
+// DefaultLayouts are the timestamp layouts ParseHNQuery accepts, tried in order :
+// HN dates, and RFC 3339 dates with optional fractional seconds and offsets (e.g. 2015-08-01T00:03:43.123+02:00)
+var DefaultLayouts = []string{constant.DateFormat, time.RFC3339Nano}
+
 // ParseHNQuery will parse a string with the following format : <YYYY-MM-DD HH:mm:SS><tab><url>
 // An error is return when the string does not respect this format.
 func ParseHNQuery(str string) (*ParsedQuery, error) {
+	return ParseHNQueryWithLayouts(str, DefaultLayouts)
+}
+
+// ParseHNQueryWithLayouts will parse a string with the following format : <date><tab><url>
+// where the date respects one of the given layouts. The parsed time is normalized to UTC.
+// An error is return when the string does not respect this format.
+func ParseHNQueryWithLayouts(str string, layouts []string) (*ParsedQuery, error) {
 	words := strings.Split(str, constant.Tab)
 
 	var parsedQuery ParsedQuery
@@ -24,13 +37,25 @@ func ParseHNQuery(str string) (*ParsedQuery, error) {
 		return &parsedQuery, errors.New("Unable to parse line : " + str)
 	}
 
-	time, timeErr := time.Parse(constant.DateFormat, words[0])
+	time, timeErr := ParseTime(words[0], layouts)
 	if timeErr != nil {
-		return &parsedQuery, errors.New("Unable to parse date from : " + words[0])
+		return &parsedQuery, timeErr
 	}
 
 	url := words[1]
 
-	parsedQuery = ParsedQuery{time, url}
+	parsedQuery = ParsedQuery{time, url, nil}
 	return &parsedQuery, nil
 }
+
+// ParseTime parses a timestamp with the first of the layouts that matches, and normalizes it to UTC
+func ParseTime(str string, layouts []string) (time.Time, error) {
+	for _, layout := range layouts {
+		parsed, err := time.Parse(layout, str)
+		if err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+
+	return time.Time{}, errors.New("Unable to parse date from : " + str)
+}
@@ -11,7 +11,7 @@ import (
 func Test_ValidHNQuery_ShouldBeParsed(t *testing.T) {
 	timeParsed, _ := time.Parse(constant.DateFormat, constant.DateAsString)
 
-	expectedQuery := ParsedQuery{timeParsed, constant.URLAsString}
+	expectedQuery := ParsedQuery{timeParsed, constant.URLAsString, nil}
 	parsedQuery, _ := ParseHNQuery(constant.CorrectLine)
 
 	assert.Equal(t, expectedQuery, *parsedQuery, "A valid HN query should be parsed")
@@ -27,3 +27,37 @@ func Test_InvalidDate_ShouldReturnError(t *testing.T) {
 	_, err := ParseHNQuery("not-a-date" + constant.Tab + constant.URLAsString)
 	assert.EqualError(t, err, "Unable to parse date from : not-a-date", "An invalid date should not be parsed")
 }
+
+func Test_RFC3339Dates_ShouldBeParsedToUTC(t *testing.T) {
+	expected, _ := time.Parse(constant.DateFormat, constant.DateAsString)
+
+	for _, date := range []string{"2015-08-01T00:03:43Z", "2015-08-01T00:03:43.123Z", "2015-08-01T02:03:43+02:00", "2015-07-31T23:03:43.5-01:00"} {
+		parsedQuery, err := ParseHNQuery(date + constant.Tab + constant.URLAsString)
+		assert.NoError(t, err, date+" should be parsed")
+		assert.Equal(t, time.UTC, parsedQuery.Time.Location(), date+" should be normalized to UTC")
+		assert.Equal(t, expected, parsedQuery.Time.Truncate(time.Second), date+" should be the same second as "+constant.DateAsString)
+	}
+}
+
+func Test_FractionalSeconds_ShouldBeParsed(t *testing.T) {
+	parsedQuery, err := ParseHNQuery(constant.DateAsString + ".250" + constant.Tab + constant.URLAsString)
+	assert.NoError(t, err, "A HN date with fractional seconds should be parsed")
+	assert.Equal(t, 250*time.Millisecond, time.Duration(parsedQuery.Time.Nanosecond()), "Fractional seconds should be kept")
+}
+
+func Test_CustomLayouts_ShouldBeUsed(t *testing.T) {
+	line := "01/08/2015 00:03:43" + constant.Tab + constant.URLAsString
+
+	_, err := ParseHNQuery(line)
+	assert.Error(t, err, "A date in an unknown layout should not be parsed")
+
+	parsedQuery, err := ParseHNQueryWithLayouts(line, []string{"02/01/2006 15:04:05"})
+	expected, _ := time.Parse(constant.DateFormat, constant.DateAsString)
+	assert.NoError(t, err, "A date in a configured layout should be parsed")
+	assert.Equal(t, expected, parsedQuery.Time, "A date in a configured layout should be parsed")
+}
+
+func Test_ParseTime_NoLayout_ShouldFail(t *testing.T) {
+	_, err := ParseTime(constant.DateAsString, []string{})
+	assert.EqualError(t, err, "Unable to parse date from : "+constant.DateAsString, "A date cannot be parsed without layouts")
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"container/heap"
 	"errors"
 	"sort"
 	"time"
@@ -18,12 +19,29 @@ const (
 	secondFormat = "2006-01-02 15:04:05"
 )
 
+// Layouts of the date prefixes the API supports, by key type
+var layouts = map[util.KeyType]string{
+	util.Year:   yearFormat,
+	util.Month:  monthFormat,
+	util.Day:    dayFormat,
+	util.Minute: minuteFormat,
+}
+
 // QueryResult : a single query with a count associated
 type QueryResult struct {
 	Query string `json:"query"`
 	Count int    `json:"count"`
 }
 
+// DatePrefixError : a date prefix having the shape of its key type, but not being a date (e.g. 2015-13)
+type DatePrefixError struct {
+	DatePrefix string
+}
+
+func (err *DatePrefixError) Error() string {
+	return "Could not parse datePrefix : " + err.DatePrefix
+}
+
 // CountURLs : counts URL occurences for the given couple datePrefix/keyType.
 // Parameters datePrefix and keyType are assumed to be a match (e.g. datePrefix="2015" => keyType=util.Year)
 func CountURLs(index *index.Index, datePrefix string, keyType util.KeyType) (int, error) {
@@ -45,68 +63,174 @@ func FindTopNQueries(index *index.Index, datePrefix string, keyType util.KeyType
 		return nil, err
 	}
 
-	queriesForDate := make([]QueryResult, 0, len(value))
-	for urlID, count := range value {
-		url := index.IDstoURL[urlID]
-		queriesForDate = append(queriesForDate, QueryResult{url, count})
-	}
+	return top(index, value, n), nil
+}
 
-	sort.Slice(queriesForDate, func(i, j int) bool {
-		return queriesForDate[i].Count > queriesForDate[j].Count
+// FindTopNQueriesBetween : searches the top n queries made during the minutes overlapping the period from-to.
+// Queries are counted minute by minute : the minutes of from and to are counted as a whole.
+func FindTopNQueriesBetween(index *index.Index, from, to time.Time, n int) []QueryResult {
+	counts := make(map[int]int)
+	index.Tree.AscendRange(int(util.MinuteKey(from)), int(util.MinuteKey(to)), func(key int, values map[int]int) bool {
+		for urlID, count := range values {
+			counts[urlID] += count
+		}
+		return true
 	})
 
-	if n > len(queriesForDate) {
-		return queriesForDate, nil
+	return top(index, counts, n)
+}
+
+// RankQueries : the queries for the given couple datePrefix/keyType, to be taken the most counted first, see Ranking.
+// Parameters datePrefix and keyType are assumed to be a match (e.g. datePrefix="2015" => keyType=util.Year)
+func RankQueries(index *index.Index, datePrefix string, keyType util.KeyType) (*Ranking, error) {
+	value, err := PerformSearch(index, datePrefix, keyType)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return queriesForDate[:n], nil
+	return &Ranking{queries: results(index, value)}, nil
 }
 
-// PerformSearch : perform a search on the index
-func PerformSearch(index *index.Index, datePrefix string, keyType util.KeyType) (map[int]int, error) {
-	var key int
+// Ranking : queries handed out one at a time, in the order of FindTopNQueries. It holds no reference to the index,
+// and queries are only ordered as they are taken : taking the first ones does not sort them all.
+type Ranking struct {
+	queries rankingHeap
+	ordered bool
+}
 
-	switch keyType {
-	case util.Year:
-		datePrefixAsTime, parseError := time.Parse(yearFormat, datePrefix)
+// Next : the most counted query not taken yet, false when every query was taken
+func (ranking *Ranking) Next() (QueryResult, bool) {
+	if !ranking.ordered {
+		heap.Init(&ranking.queries)
+		ranking.ordered = true
+	}
 
-		if parseError != nil {
-			return nil, errors.New("Could not parse datePrefix : " + datePrefix)
-		}
+	if len(ranking.queries) == 0 {
+		return QueryResult{}, false
+	}
 
-		key = util.YearKey(datePrefixAsTime)
-		return index.Tree.Get(key), nil
+	return heap.Pop(&ranking.queries).(QueryResult), true
+}
 
-	case util.Month:
-		datePrefixAsTime, parseError := time.Parse(monthFormat, datePrefix)
+// rankingHeap : a heap of queries, the most counted on top
+type rankingHeap []QueryResult
 
-		if parseError != nil {
-			return nil, errors.New("Could not parse datePrefix : " + datePrefix)
-		}
+func (queries rankingHeap) Len() int           { return len(queries) }
+func (queries rankingHeap) Less(i, j int) bool { return before(queries[i], queries[j]) }
+func (queries rankingHeap) Swap(i, j int)      { queries[i], queries[j] = queries[j], queries[i] }
 
-		key = util.MonthKey(datePrefixAsTime)
-		return index.Tree.Get(key), nil
+func (queries *rankingHeap) Push(query interface{}) {
+	*queries = append(*queries, query.(QueryResult))
+}
 
-	case util.Day:
-		datePrefixAsTime, parseError := time.Parse(dayFormat, datePrefix)
+func (queries *rankingHeap) Pop() interface{} {
+	last := (*queries)[len(*queries)-1]
+	*queries = (*queries)[:len(*queries)-1]
+	return last
+}
 
-		if parseError != nil {
-			return nil, errors.New("Could not parse datePrefix : " + datePrefix)
-		}
+// before : whether a query ranks before another one : counted more, or as many times and alphabetically first
+func before(query, other QueryResult) bool {
+	if query.Count != other.Count {
+		return query.Count > other.Count
+	}
+	return query.Query < other.Query
+}
 
-		key = util.DayKey(datePrefixAsTime)
-		return index.Tree.Get(key), nil
+// results : the counted URLs, in no particular order
+func results(index *index.Index, counts map[int]int) []QueryResult {
+	queries := make([]QueryResult, 0, len(counts))
+	for urlID, count := range counts {
+		url := index.IDstoURL[urlID]
+		queries = append(queries, QueryResult{url, count})
+	}
 
-	case util.Minute:
-		lower, parseError := time.Parse(minuteFormat, datePrefix)
+	return queries
+}
 
-		if parseError != nil {
-			return nil, errors.New("Could not parse datePrefix : " + datePrefix)
+// top : the n URLs counted the most, the most counted first. URLs counted as many times are ordered alphabetically.
+func top(index *index.Index, counts map[int]int, n int) []QueryResult {
+	queries := results(index, counts)
+	sort.Slice(queries, func(i, j int) bool {
+		return before(queries[i], queries[j])
+	})
+
+	if n > len(queries) {
+		return queries
+	}
+
+	return queries[:n]
+}
+
+// Histogram : splits the period of the given couple datePrefix/keyType into intervals (e.g. the hours of a day),
+// and counts the queries made during each of them. Intervals during which no query was made are left out.
+// interval must be finer than keyType, and no finer than a minute.
+func Histogram(index *index.Index, datePrefix string, keyType util.KeyType, interval util.KeyType) ([]Bucket, error) {
+	if interval <= keyType || interval > util.Minute {
+		return nil, &IntervalError{interval, keyType}
+	}
+
+	key, err := keyOf(datePrefix, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys of a granularity are contiguous and chronological : the intervals of the period lie between the key of its start,
+	// and the one of the start of the next period (excluded)
+	start, end := key.Range()
+	lower, higher := util.NewKey(interval, start), util.NewKey(interval, end)
+
+	buckets := []Bucket{}
+	index.Tree.AscendRange(int(lower), int(higher)-1, func(key int, values map[int]int) bool {
+		total := 0
+		for _, count := range values {
+			total += count
 		}
+		buckets = append(buckets, Bucket{util.Key(key).Time(), len(values), total})
+		return true
+	})
+
+	return buckets, nil
+}
+
+// Bucket : the queries made during an interval of a histogram. Count is the number of distinct queries, as CountURLs, Total the number of queries.
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	Total int       `json:"total"`
+}
+
+// IntervalError : an interval a period cannot be split into
+type IntervalError struct {
+	Interval util.KeyType
+	KeyType  util.KeyType
+}
+
+func (err *IntervalError) Error() string {
+	return "Could not split a " + err.KeyType.String() + " by " + err.Interval.String() + " : the interval should be finer, and at least a minute"
+}
+
+// PerformSearch : perform a search on the index
+func PerformSearch(index *index.Index, datePrefix string, keyType util.KeyType) (map[int]int, error) {
+	key, err := keyOf(datePrefix, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	return index.Get(key), nil
+}
+
+func keyOf(datePrefix string, keyType util.KeyType) (util.Key, error) {
+	layout, supported := layouts[keyType]
+	if !supported {
+		return 0, errors.New("No key was extracted. This is an error")
+	}
 
-		key = util.MinuteKey(lower)
-		return index.Tree.Get(key), nil
+	datePrefixAsTime, parseError := time.Parse(layout, datePrefix)
+	if parseError != nil {
+		return 0, &DatePrefixError{datePrefix}
 	}
 
-	return nil, errors.New("No key was extracted. This is an error")
+	return util.NewKey(keyType, datePrefixAsTime), nil
 }
@@ -2,6 +2,7 @@ package query
 
 import (
 	"testing"
+	"time"
 
 	"github.com/thomaspepio/hn-queries/util"
 
@@ -168,3 +169,92 @@ func Test_TopNQueries(t *testing.T) {
 	value, _ = FindTopNQueries(index, "2021-01-01", util.Day, 2)
 	assert.Equal(t, 1, len(value), "There should be one top query since we indexed this url only once")
 }
+
+func Test_RankQueries_ShouldHandOutTopQueriesInOrder(t *testing.T) {
+	index := index.EmptyIndex()
+	for _, url := range []string{"http://b", "http://a", "http://c", "http://c", "http://b", "http://d"} {
+		parsedQuery, _ := parser.ParseHNQuery(constant.DateAsString + constant.Tab + url)
+		index.Add(parsedQuery)
+	}
+
+	ranking, err := RankQueries(index, "2015-08", util.Month)
+	assert.NoError(t, err, "Ranking a valid date prefix should succeed")
+
+	ranked := []QueryResult{}
+	for query, found := ranking.Next(); found; query, found = ranking.Next() {
+		ranked = append(ranked, query)
+	}
+	expected, _ := FindTopNQueries(index, "2015-08", util.Month, 10)
+	assert.Equal(t, expected, ranked, "Queries should be handed out in the order of FindTopNQueries")
+
+	_, found := ranking.Next()
+	assert.False(t, found, "No query should be left once every one was taken")
+
+	_, err = RankQueries(index, "2015-13", util.Month)
+	assert.Error(t, err, "Ranking an invalid date prefix should fail")
+}
+
+func Test_Histogram_ShouldCountQueriesByInterval(t *testing.T) {
+	index := index.EmptyIndex()
+	for _, line := range []string{
+		"2021-01-01 00:01:00	Foo",
+		"2021-01-01 00:01:15	Foo",
+		"2021-01-01 00:01:30	Bar",
+		"2021-01-01 03:10:00	Foo",
+		"2021-01-02 00:00:00	Baz",
+		"2020-12-31 23:59:59	Baz",
+	} {
+		parsedQuery, _ := parser.ParseHNQuery(line)
+		index.Add(parsedQuery)
+	}
+
+	buckets, err := Histogram(index, "2021-01-01", util.Day, util.Hour)
+	assert.NoError(t, err, "A day should be split by hours")
+	assert.Equal(t, []Bucket{
+		{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), 2, 3},
+		{time.Date(2021, 1, 1, 3, 0, 0, 0, time.UTC), 1, 1},
+	}, buckets, "Only the hours of the day during which queries were made should be counted")
+
+	buckets, _ = Histogram(index, "2021", util.Year, util.Month)
+	assert.Equal(t, []Bucket{{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), 3, 5}}, buckets, "The queries of 2020 should be left out")
+
+	buckets, _ = Histogram(index, "2021-02", util.Month, util.Minute)
+	assert.Equal(t, []Bucket{}, buckets, "No query was made in February")
+}
+
+func Test_Histogram_ShouldFail(t *testing.T) {
+	index := index.EmptyIndex()
+
+	_, err := Histogram(index, "2021-01-01", util.Day, util.Month)
+	assert.Error(t, err, "A day cannot be split by months")
+
+	_, err = Histogram(index, "2021-01-01", util.Day, util.Second)
+	assert.Error(t, err, "Seconds are not indexed")
+
+	_, err = Histogram(index, "2021-13", util.Month, util.Day)
+	assert.Equal(t, &DatePrefixError{"2021-13"}, err, "2021-13 is not a month")
+}
+
+func Test_FindTopNQueriesBetween_ShouldCountMinutesOfPeriod(t *testing.T) {
+	index := index.EmptyIndex()
+	for _, line := range []string{
+		"2021-01-01 00:01:59	Foo",
+		"2021-01-01 00:02:00	Bar",
+		"2021-01-01 00:02:30	Bar",
+		"2021-01-01 00:04:10	Baz",
+		"2021-01-01 00:05:00	Foo",
+		"2021-01-01 01:04:00	Foo",
+	} {
+		parsedQuery, _ := parser.ParseHNQuery(line)
+		index.Add(parsedQuery)
+	}
+
+	from := time.Date(2021, 1, 1, 0, 2, 15, 0, time.UTC)
+	to := time.Date(2021, 1, 1, 0, 4, 59, 0, time.UTC)
+	assert.Equal(t, []QueryResult{{"Bar", 2}, {"Baz", 1}}, FindTopNQueriesBetween(index, from, to, 10), "Only the minutes from 00:02 to 00:04 should be counted")
+	assert.Equal(t, []QueryResult{{"Bar", 2}}, FindTopNQueriesBetween(index, from, to, 1), "Only the top query should be kept")
+
+	from = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to = time.Date(2021, 1, 1, 0, 5, 0, 0, time.UTC)
+	assert.Equal(t, []QueryResult{{"Bar", 2}, {"Foo", 2}, {"Baz", 1}}, FindTopNQueriesBetween(index, from, to, 10), "Ties should be ordered alphabetically")
+}
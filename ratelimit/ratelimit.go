@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket : a token bucket, holding burst tokens at most and refilled with rate tokens per second.
+// Each request takes a token, and is rejected when none is left.
+type Bucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket : creates a full bucket. A burst lower than 1 is 1.
+func NewBucket(rate float64, burst int, now time.Time) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Bucket{rate: rate, burst: burst, tokens: float64(burst), last: now}
+}
+
+// Take : takes a token when there is one left, or else tells how long until there is one
+func (bucket *Bucket) Take(now time.Time) (bool, time.Duration) {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(float64(bucket.burst), bucket.tokens+elapsed.Seconds()*bucket.rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	missing := 1 - bucket.tokens
+	return false, time.Duration(missing / bucket.rate * float64(time.Second))
+}
+
+// Limiter : one bucket per key (e.g. per API key). Requests of keys without a rate are never limited.
+type Limiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*Bucket
+}
+
+// NewLimiter : creates a limiter with no bucket
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*Bucket)}
+}
+
+// Take : takes a token from the bucket of key, see Bucket.Take. The bucket is created full the first time the key is seen,
+// and created again when its rate or burst changed (e.g. when the configuration is reloaded).
+func (limiter *Limiter) Take(key string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	if rate <= 0 {
+		return true, 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	limiter.mutex.Lock()
+	bucket, found := limiter.buckets[key]
+	if !found || bucket.rate != rate || bucket.burst != burst {
+		bucket = NewBucket(rate, burst, now)
+		limiter.buckets[key] = bucket
+	}
+	limiter.mutex.Unlock()
+
+	return bucket.Take(now)
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bucket_ShouldAllowBurstThenRate(t *testing.T) {
+	now := time.Now()
+	bucket := NewBucket(2, 3, now)
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := bucket.Take(now)
+		assert.True(t, allowed, "A full bucket should allow a burst of requests")
+	}
+
+	allowed, retryAfter := bucket.Take(now)
+	assert.False(t, allowed, "An empty bucket should reject requests")
+	assert.Equal(t, 500*time.Millisecond, retryAfter, "A token should be back after 1/rate seconds")
+
+	allowed, _ = bucket.Take(now.Add(500 * time.Millisecond))
+	assert.True(t, allowed, "A refilled token should allow a request")
+
+	allowed, _ = bucket.Take(now.Add(time.Hour))
+	assert.True(t, allowed, "A bucket should refill over time")
+	assert.Equal(t, 2.0, bucket.tokens, "A bucket should not hold more than its burst")
+}
+
+func Test_Limiter_ShouldLimitEachKeyApart(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter()
+
+	allowed, _ := limiter.Take("foo", 1, 1, now)
+	assert.True(t, allowed, "The first request of a key should be allowed")
+	allowed, _ = limiter.Take("foo", 1, 1, now)
+	assert.False(t, allowed, "A key above its rate should be limited")
+	allowed, _ = limiter.Take("bar", 1, 1, now)
+	assert.True(t, allowed, "Keys should not share their bucket")
+
+	allowed, _ = limiter.Take("foo", 1, 2, now)
+	assert.True(t, allowed, "A change of burst should start a new bucket")
+
+	for i := 0; i < 100; i++ {
+		allowed, _ = limiter.Take("baz", 0, 0, now)
+		assert.True(t, allowed, "A key without rate should never be limited")
+	}
+}
@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/thomaspepio/hn-queries/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// The metadata carrying the API key, which can also be sent as a bearer token
+	apiKeyMetadata = "x-api-key"
+
+	// The metadata telling in how many seconds a rate limited call can be retried, as the Retry-After header of the HTTP API
+	retryAfterMetadata = "retry-after"
+)
+
+// presentedKey : the API key the call carries, from the x-api-key metadata or else as a bearer token
+func presentedKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(apiKeyMetadata); len(keys) > 0 && keys[0] != "" {
+		return keys[0]
+	}
+
+	if authorizations := md.Get("authorization"); len(authorizations) > 0 {
+		return config.BearerToken(authorizations[0])
+	}
+
+	return ""
+}
+
+// authenticate : rejects calls whose API key does not grant the query role, and limits the rate of the others to the one of their key,
+// as the HTTP API does. Every call is let through when no API key is configured.
+func authenticate(ctx context.Context, source Source) error {
+	configuration := source.Configuration()
+	if len(configuration.APIKeys) == 0 {
+		return nil
+	}
+
+	key, found := configuration.FindAPIKey(presentedKey(ctx))
+	if !found {
+		return status.Error(codes.Unauthenticated, "Missing or unknown API key")
+	}
+
+	if !key.Grants(config.RoleQuery) {
+		return status.Error(codes.PermissionDenied, "The API key "+key.Name+" is not granted the "+config.RoleQuery+" role")
+	}
+
+	allowed, wait := source.Limiter().Take(key.Key, key.RateLimit, key.Burst, time.Now())
+	if !allowed {
+		retryAfter := int(math.Max(1, math.Ceil(wait.Seconds())))
+		grpc.SetHeader(ctx, metadata.Pairs(retryAfterMetadata, strconv.Itoa(retryAfter)))
+		return status.Error(codes.ResourceExhausted, "Too many requests for the API key "+key.Name)
+	}
+
+	return nil
+}
+
+// authenticateUnary : see authenticate
+func authenticateUnary(source Source) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authenticate(ctx, source); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, request)
+	}
+}
+
+// authenticateStream : see authenticate
+func authenticateStream(source Source) grpc.StreamServerInterceptor {
+	return func(server interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authenticate(stream.Context(), source); err != nil {
+			return err
+		}
+
+		return handler(server, stream)
+	}
+}
@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// withKeys : a source of the test queries, whose calls expect one of keys
+func withKeys(keys ...config.APIKey) source {
+	configuration := config.Default()
+	configuration.APIKeys = keys
+	return source{index: indexOf(lines...), configuration: configuration, limiter: ratelimit.NewLimiter()}
+}
+
+func withMetadata(pairs ...string) context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+// streamError : the error of a StreamPopular call, be it returned when the stream is opened or when it is read
+func streamError(client QueriesClient, ctx context.Context) error {
+	stream, err := client.StreamPopular(ctx, &PopularRequest{DatePrefix: "2015"})
+	if err != nil {
+		return err
+	}
+
+	_, err = stream.Recv()
+	return err
+}
+
+func Test_Authenticate_WithoutKeys_ShouldBeOpen(t *testing.T) {
+	client := dial(t, source{index: indexOf(lines...)})
+
+	_, err := client.Count(context.Background(), &CountRequest{DatePrefix: "2015"})
+	assert.NoError(t, err, "Calls should be open when no API key is configured")
+	assert.NoError(t, streamError(client, context.Background()), "Streams should be open when no API key is configured")
+}
+
+func Test_Authenticate_MissingOrUnknownKey_ShouldBeUnauthenticated(t *testing.T) {
+	client := dial(t, withKeys(config.APIKey{Name: "dashboard", Key: "query-key", Role: config.RoleQuery}))
+
+	for name, ctx := range map[string]context.Context{
+		"A missing key":                        context.Background(),
+		"An unknown key":                       withMetadata("x-api-key", "unknown-key"),
+		"A key sent without the Bearer scheme": withMetadata("authorization", "query-key"),
+	} {
+		_, err := client.Count(ctx, &CountRequest{DatePrefix: "2015"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), name+" should be unauthenticated")
+
+		_, err = client.Popular(ctx, &PopularRequest{DatePrefix: "2015"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), name+" should be unauthenticated")
+
+		assert.Equal(t, codes.Unauthenticated, status.Code(streamError(client, ctx)), name+" should not open a stream")
+	}
+}
+
+func Test_Authenticate_QueryKey_ShouldBeLetThrough(t *testing.T) {
+	client := dial(t, withKeys(
+		config.APIKey{Name: "dashboard", Key: "query-key", Role: config.RoleQuery},
+		config.APIKey{Name: "ops", Key: "admin-key", Role: config.RoleAdmin},
+	))
+
+	_, err := client.Count(withMetadata("x-api-key", "query-key"), &CountRequest{DatePrefix: "2015"})
+	assert.NoError(t, err, "A query key should open the service")
+
+	_, err = client.Popular(withMetadata("authorization", "bearer admin-key"), &PopularRequest{DatePrefix: "2015"})
+	assert.NoError(t, err, "An admin key sent as a bearer token should open the service")
+
+	assert.NoError(t, streamError(client, withMetadata("x-api-key", "query-key")), "A query key should open streams")
+}
+
+func Test_Authenticate_KeyWithoutRole_ShouldBePermissionDenied(t *testing.T) {
+	// An ingest key only opens the ingest endpoint, not the queries
+	client := dial(t, withKeys(config.APIKey{Name: "shipper", Key: "other-key", Role: config.RoleIngest}))
+	ctx := withMetadata("x-api-key", "other-key")
+
+	_, err := client.Count(ctx, &CountRequest{DatePrefix: "2015"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "A key lacking the query role should be denied")
+	assert.Equal(t, codes.PermissionDenied, status.Code(streamError(client, ctx)), "A key lacking the query role should not open a stream")
+}
+
+func Test_Authenticate_AboveRate_ShouldBeResourceExhausted(t *testing.T) {
+	source := withKeys(config.APIKey{Name: "dashboard", Key: "query-key", Role: config.RoleQuery, RateLimit: 0.5, Burst: 2})
+	client := dial(t, source)
+	ctx := withMetadata("x-api-key", "query-key")
+
+	_, err := client.Count(ctx, &CountRequest{DatePrefix: "2015"})
+	assert.NoError(t, err, "Calls within the burst should be allowed")
+	assert.NoError(t, streamError(client, ctx), "Calls within the burst should be allowed")
+
+	var header metadata.MD
+	_, err = client.Popular(ctx, &PopularRequest{DatePrefix: "2015"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "Calls above the rate should be limited")
+	assert.Equal(t, []string{"2"}, header.Get("retry-after"), "A limited call should tell when to retry")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(streamError(client, ctx)), "Streams above the rate should be limited")
+
+	allowed, _ := source.limiter.Take("query-key", 0.5, 2, time.Now())
+	assert.False(t, allowed, "The limiter of the HTTP API should be the one drained")
+}
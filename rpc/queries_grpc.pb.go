@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// QueriesClient is the client API for Queries service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type QueriesClient interface {
+	// Count : counts the distinct queries made during a period, see query.CountURLs
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	// Popular : lists the most popular queries made during a period, see query.FindTopNQueries
+	Popular(ctx context.Context, in *PopularRequest, opts ...grpc.CallOption) (*PopularResponse, error)
+	// StreamPopular : streams the most popular queries made during a period, one message per query, the most popular first.
+	// The size is applied as Popular does : a size of 0 streams as many queries as the default size of the server,
+	// and a size greater than its maximum size is clamped to it.
+	StreamPopular(ctx context.Context, in *PopularRequest, opts ...grpc.CallOption) (Queries_StreamPopularClient, error)
+}
+
+type queriesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQueriesClient(cc grpc.ClientConnInterface) QueriesClient {
+	return &queriesClient{cc}
+}
+
+func (c *queriesClient) Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, "/hnqueries.v1.Queries/Count", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queriesClient) Popular(ctx context.Context, in *PopularRequest, opts ...grpc.CallOption) (*PopularResponse, error) {
+	out := new(PopularResponse)
+	err := c.cc.Invoke(ctx, "/hnqueries.v1.Queries/Popular", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queriesClient) StreamPopular(ctx context.Context, in *PopularRequest, opts ...grpc.CallOption) (Queries_StreamPopularClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Queries_ServiceDesc.Streams[0], "/hnqueries.v1.Queries/StreamPopular", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queriesStreamPopularClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Queries_StreamPopularClient interface {
+	Recv() (*QueryResult, error)
+	grpc.ClientStream
+}
+
+type queriesStreamPopularClient struct {
+	grpc.ClientStream
+}
+
+func (x *queriesStreamPopularClient) Recv() (*QueryResult, error) {
+	m := new(QueryResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// QueriesServer is the server API for Queries service.
+// All implementations must embed UnimplementedQueriesServer
+// for forward compatibility
+type QueriesServer interface {
+	// Count : counts the distinct queries made during a period, see query.CountURLs
+	Count(context.Context, *CountRequest) (*CountResponse, error)
+	// Popular : lists the most popular queries made during a period, see query.FindTopNQueries
+	Popular(context.Context, *PopularRequest) (*PopularResponse, error)
+	// StreamPopular : streams the most popular queries made during a period, one message per query, the most popular first.
+	// The size is applied as Popular does : a size of 0 streams as many queries as the default size of the server,
+	// and a size greater than its maximum size is clamped to it.
+	StreamPopular(*PopularRequest, Queries_StreamPopularServer) error
+	mustEmbedUnimplementedQueriesServer()
+}
+
+// UnimplementedQueriesServer must be embedded to have forward compatible implementations.
+type UnimplementedQueriesServer struct {
+}
+
+func (UnimplementedQueriesServer) Count(context.Context, *CountRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedQueriesServer) Popular(context.Context, *PopularRequest) (*PopularResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Popular not implemented")
+}
+func (UnimplementedQueriesServer) StreamPopular(*PopularRequest, Queries_StreamPopularServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamPopular not implemented")
+}
+func (UnimplementedQueriesServer) mustEmbedUnimplementedQueriesServer() {}
+
+// UnsafeQueriesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QueriesServer will
+// result in compilation errors.
+type UnsafeQueriesServer interface {
+	mustEmbedUnimplementedQueriesServer()
+}
+
+func RegisterQueriesServer(s grpc.ServiceRegistrar, srv QueriesServer) {
+	s.RegisterService(&Queries_ServiceDesc, srv)
+}
+
+func _Queries_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueriesServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hnqueries.v1.Queries/Count",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueriesServer).Count(ctx, req.(*CountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queries_Popular_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PopularRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueriesServer).Popular(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/hnqueries.v1.Queries/Popular",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueriesServer).Popular(ctx, req.(*PopularRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Queries_StreamPopular_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PopularRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueriesServer).StreamPopular(m, &queriesStreamPopularServer{stream})
+}
+
+type Queries_StreamPopularServer interface {
+	Send(*QueryResult) error
+	grpc.ServerStream
+}
+
+type queriesStreamPopularServer struct {
+	grpc.ServerStream
+}
+
+func (x *queriesStreamPopularServer) Send(m *QueryResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Queries_ServiceDesc is the grpc.ServiceDesc for Queries service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Queries_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hnqueries.v1.Queries",
+	HandlerType: (*QueriesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Count",
+			Handler:    _Queries_Count_Handler,
+		},
+		{
+			MethodName: "Popular",
+			Handler:    _Queries_Popular_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamPopular",
+			Handler:       _Queries_StreamPopular_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "queries.proto",
+}
@@ -0,0 +1,199 @@
+package rpc
+
+// queries.pb.go and queries_grpc.pb.go are generated from queries.proto by buf, with the plugins pinned in buf.gen.yaml.
+// buf compiles queries.proto itself : the generated code names no protoc version.
+//go:generate go run github.com/bufbuild/buf/cmd/buf@v1.28.1 generate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/query"
+	"github.com/thomaspepio/hn-queries/ratelimit"
+	"github.com/thomaspepio/hn-queries/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Source : where the service reads the index and the size settings from, so that it serves the same index as the HTTP API
+type Source interface {
+	// Index : the index, read-locked until the returned function is called. It is nil while the index is loading.
+	Index() (*index.Index, func())
+
+	// Sizes : the default and maximum sizes of popular queries
+	Sizes() (int, int)
+
+	// Configuration : the configuration, whose API keys calls are checked against
+	Configuration() *config.Config
+
+	// Limiter : the rate limiter of the API keys, shared with the HTTP API
+	Limiter() *ratelimit.Limiter
+}
+
+// Server : the Queries service
+type Server struct {
+	UnimplementedQueriesServer
+	source Source
+}
+
+// NewServer : a gRPC server serving the Queries service from source.
+// Calls are authenticated and rate limited with the API keys of the configuration, as the HTTP API is, see authenticate.
+func NewServer(source Source, options ...grpc.ServerOption) *grpc.Server {
+	options = append(options, grpc.ChainUnaryInterceptor(authenticateUnary(source)), grpc.ChainStreamInterceptor(authenticateStream(source)))
+	server := grpc.NewServer(options...)
+	RegisterQueriesServer(server, &Server{source: source})
+	return server
+}
+
+// Count : see query.CountURLs
+func (server *Server) Count(_ context.Context, request *CountRequest) (*CountResponse, error) {
+	live, release := server.source.Index()
+	defer release()
+
+	filteredIndex, keyType, err := prepare(live, request.DatePrefix, request.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := query.CountURLs(filteredIndex, request.DatePrefix, keyType)
+	if err != nil {
+		return nil, asStatus(err)
+	}
+
+	return &CountResponse{Count: int64(count)}, nil
+}
+
+// Popular : see query.FindTopNQueries. A size of 0 is the default size, and a size greater than the maximum size is clamped to it.
+func (server *Server) Popular(_ context.Context, request *PopularRequest) (*PopularResponse, error) {
+	size, clamped, err := server.size(request)
+	if err != nil {
+		return nil, err
+	}
+
+	queries, err := server.popular(request, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PopularResponse{Queries: queries, Size: int32(size), Clamped: clamped}, nil
+}
+
+// StreamPopular : streams the most popular queries, sized as Popular is.
+// The index is only held while the queries are counted : they are then ranked as they are sent, see query.Ranking,
+// so that neither a slow client holds the index, nor the first query waits for every query to be sorted.
+func (server *Server) StreamPopular(request *PopularRequest, stream Queries_StreamPopularServer) error {
+	size, _, err := server.size(request)
+	if err != nil {
+		return err
+	}
+
+	ranking, err := server.ranking(request)
+	if err != nil {
+		return err
+	}
+
+	for sent := 0; sent < size; sent++ {
+		topQuery, found := ranking.Next()
+		if !found {
+			break
+		}
+		if err := stream.Send(&QueryResult{Query: topQuery.Query, Count: int64(topQuery.Count)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// size : the size of a popular request, and whether it was clamped. A size of 0 is the default size,
+// and a size greater than the maximum size is clamped to it.
+func (server *Server) size(request *PopularRequest) (int, bool, error) {
+	if request.Size < 0 {
+		return -1, false, status.Error(codes.InvalidArgument, "Wrong size parameter : size should not be negative")
+	}
+
+	defaultSize, maxSize := server.source.Sizes()
+	size, clamped := int(request.Size), false
+	if size == 0 {
+		size = defaultSize
+	}
+	if size > maxSize {
+		size, clamped = maxSize, true
+	}
+
+	return size, clamped, nil
+}
+
+func (server *Server) ranking(request *PopularRequest) (*query.Ranking, error) {
+	live, release := server.source.Index()
+	defer release()
+
+	filteredIndex, keyType, err := prepare(live, request.DatePrefix, request.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	ranking, err := query.RankQueries(filteredIndex, request.DatePrefix, keyType)
+	if err != nil {
+		return nil, asStatus(err)
+	}
+
+	return ranking, nil
+}
+
+func (server *Server) popular(request *PopularRequest, size int) ([]*QueryResult, error) {
+	live, release := server.source.Index()
+	defer release()
+
+	filteredIndex, keyType, err := prepare(live, request.DatePrefix, request.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	topQueries, err := query.FindTopNQueries(filteredIndex, request.DatePrefix, keyType, size)
+	if err != nil {
+		return nil, asStatus(err)
+	}
+
+	queries := make([]*QueryResult, len(topQueries))
+	for i, topQuery := range topQueries {
+		queries[i] = &QueryResult{Query: topQuery.Query, Count: int64(topQuery.Count)}
+	}
+
+	return queries, nil
+}
+
+// prepare : checks the index is loaded, identifies the date prefix and applies the filters
+func prepare(live *index.Index, datePrefix string, filters map[string]string) (*index.Index, util.KeyType, error) {
+	if live == nil {
+		return nil, -1, status.Error(codes.Unavailable, "The index is still loading")
+	}
+
+	keyType, err := util.IdentifyKey(datePrefix)
+	if err != nil {
+		return nil, -1, asStatus(err)
+	}
+
+	filteredIndex, err := live.Filter(filters)
+	if err != nil {
+		return nil, -1, asStatus(err)
+	}
+
+	return filteredIndex, keyType, nil
+}
+
+// asStatus : maps an error to a gRPC status, the way the HTTP API maps it to an HTTP status
+func asStatus(err error) error {
+	var keyError *util.KeyError
+	var datePrefixError *query.DatePrefixError
+	var filterError *index.FilterError
+
+	if errors.As(err, &keyError) || errors.As(err, &datePrefixError) || errors.As(err, &filterError) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomaspepio/hn-queries/config"
+	"github.com/thomaspepio/hn-queries/constant"
+	"github.com/thomaspepio/hn-queries/index"
+	"github.com/thomaspepio/hn-queries/parser"
+	"github.com/thomaspepio/hn-queries/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type source struct {
+	index         *index.Index
+	configuration *config.Config
+	limiter       *ratelimit.Limiter
+}
+
+func (source source) Index() (*index.Index, func()) {
+	return source.index, func() {}
+}
+
+func (source source) Sizes() (int, int) {
+	return 1, 2
+}
+
+func (source source) Configuration() *config.Config {
+	if source.configuration == nil {
+		return config.Default()
+	}
+
+	return source.configuration
+}
+
+func (source source) Limiter() *ratelimit.Limiter {
+	return source.limiter
+}
+
+// dial : serves the service from source on an in-process listener, and returns a client connected to it
+func dial(t *testing.T, source Source) QueriesClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewServer(source)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	connection, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithInsecure())
+	assert.NoError(t, err, "Client should have connected")
+	t.Cleanup(func() { connection.Close() })
+
+	return NewQueriesClient(connection)
+}
+
+func indexOf(lines ...string) *index.Index {
+	index := index.EmptyIndex()
+	for _, line := range lines {
+		parsedQuery, _ := parser.ParseHNQuery(line)
+		index.Add(parsedQuery)
+	}
+
+	return index
+}
+
+var lines = []string{
+	constant.CorrectLine,
+	constant.CorrectLine,
+	constant.CorrectLine,
+	constant.DateAsString + constant.Tab + "http://second-url",
+	constant.DateAsString + constant.Tab + "http://second-url",
+	constant.DateAsString + constant.Tab + "http://third-url",
+}
+
+func Test_Count_ShouldCountDistinctQueries(t *testing.T) {
+	client := dial(t, source{index: indexOf(lines...)})
+
+	response, err := client.Count(context.Background(), &CountRequest{DatePrefix: "2015-08"})
+	assert.NoError(t, err, "Count should succeed")
+	assert.Equal(t, int64(3), response.Count, "Three distinct queries should have been counted")
+}
+
+func Test_Popular_ShouldDefaultAndClampSize(t *testing.T) {
+	client := dial(t, source{index: indexOf(lines...)})
+
+	response, err := client.Popular(context.Background(), &PopularRequest{DatePrefix: "2015"})
+	assert.NoError(t, err, "Popular should succeed")
+	assert.Equal(t, 1, len(response.Queries), "The default size should apply")
+	assert.Equal(t, constant.URLAsString, response.Queries[0].Query, "The most popular query should come first")
+	assert.Equal(t, int64(3), response.Queries[0].Count, "The most popular query was made three times")
+	assert.False(t, response.Clamped, "The default size should not be clamped")
+
+	response, _ = client.Popular(context.Background(), &PopularRequest{DatePrefix: "2015", Size: 10})
+	assert.Equal(t, 2, len(response.Queries), "The size should be clamped to the maximum")
+	assert.Equal(t, int32(2), response.Size, "The clamped size should be reported")
+	assert.True(t, response.Clamped, "The size should be reported as clamped")
+}
+
+// receive : the counts of every query of a stream
+func receive(t *testing.T, stream Queries_StreamPopularClient) []int64 {
+	counts := []int64{}
+	for {
+		queryResult, err := stream.Recv()
+		if err == io.EOF {
+			return counts
+		}
+		if !assert.NoError(t, err, "Every query should have been received") {
+			return counts
+		}
+		counts = append(counts, queryResult.Count)
+	}
+}
+
+func Test_StreamPopular_ShouldStreamAsPopular(t *testing.T) {
+	client := dial(t, source{index: indexOf(lines...)})
+
+	stream, err := client.StreamPopular(context.Background(), &PopularRequest{DatePrefix: "2015-08-01"})
+	assert.NoError(t, err, "StreamPopular should succeed")
+	assert.Equal(t, []int64{3}, receive(t, stream), "As many queries as the default size should have been streamed")
+
+	stream, _ = client.StreamPopular(context.Background(), &PopularRequest{DatePrefix: "2015-08-01", Size: 10})
+	assert.Equal(t, []int64{3, 2}, receive(t, stream), "The size should be clamped to the maximum")
+
+	stream, _ = client.StreamPopular(context.Background(), &PopularRequest{DatePrefix: "2015-08-01", Size: 1})
+	assert.Equal(t, []int64{3}, receive(t, stream), "The size asked for should be streamed")
+}
+
+func Test_Queries_ShouldMapErrorsToStatuses(t *testing.T) {
+	client := dial(t, source{index: indexOf(lines...)})
+
+	_, err := client.Count(context.Background(), &CountRequest{DatePrefix: "2015-8"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "An invalid date prefix should be an invalid argument")
+
+	_, err = client.Popular(context.Background(), &PopularRequest{DatePrefix: "2015", Size: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "A negative size should be an invalid argument")
+
+	_, err = client.Count(context.Background(), &CountRequest{DatePrefix: "2015", Filters: map[string]string{"country": "FR", "user": "alice"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Filtering on two dimensions should be an invalid argument")
+
+	client = dial(t, source{})
+	_, err = client.Count(context.Background(), &CountRequest{DatePrefix: "2015"})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "Queries should be unavailable while the index is loading")
+}
@@ -3,7 +3,6 @@ package util
 import (
 	"errors"
 	"regexp"
-	"strconv"
 	"time"
 )
 
@@ -30,6 +29,37 @@ var regexpMonth = regexp.MustCompile(monthFormat)
 var regexpDay = regexp.MustCompile(dayFormat)
 var regexpMinute = regexp.MustCompile(minuteFormat)
 
+// String : the name of the granularity, e.g. "month"
+func (keyType KeyType) String() string {
+	switch keyType {
+	case Year:
+		return "year"
+	case Month:
+		return "month"
+	case Day:
+		return "day"
+	case Hour:
+		return "hour"
+	case Minute:
+		return "minute"
+	case Second:
+		return "second"
+	}
+
+	return "unknown"
+}
+
+// ParseKeyType : the granularity named name (e.g. "month"), see KeyType.String
+func ParseKeyType(name string) (KeyType, error) {
+	for keyType := Year; keyType <= Second; keyType++ {
+		if keyType.String() == name {
+			return keyType, nil
+		}
+	}
+
+	return -1, errors.New("Unknown granularity : " + name)
+}
+
 // IdentifyKey : associates a key string parameter to a supported API key type, or returns an error.
 func IdentifyKey(key string) (KeyType, error) {
 	if regexpYear.MatchString(key) {
@@ -48,101 +78,144 @@ func IdentifyKey(key string) (KeyType, error) {
 		return Minute, nil
 	}
 
-	return -1, errors.New("Could not identify key type from : " + key)
+	return -1, &KeyError{key}
 }
 
-// YearKey : makes a search key for a whole year
-func YearKey(time time.Time) int {
-	return time.Year() * 10000000000
+// KeyError : a key string parameter matching none of the formats the API supports
+type KeyError struct {
+	Key string
 }
 
-// MonthKey : makes a search key for a month in a year
-func MonthKey(time time.Time) int {
-	year := year(time.Year())
-	month := month(time.Month())
-
-	monthKey, _ := strconv.Atoi(year + month)
-	return (monthKey * 100000000)
+func (err *KeyError) Error() string {
+	return "Could not identify key type from : " + err.Key
 }
 
-// DayKey : makes a search key for a specific day
-func DayKey(time time.Time) int {
-	year := year(time.Year())
-	month := month(time.Month())
-	day := day(time.Day())
+// Key : a search key, packing a granularity (the KeyType) and the beginning of the period it covers into a uint64.
+//
+//	bits  | 44-42       | 41-26 | 25-22 | 21-17 | 16-12 | 11-6   | 5-0
+//	field | granularity | year  | month | day   | hour  | minute | second
+//
+// Fields finer than the granularity are zeroed. Keys are ordered by granularity first, then chronologically :
+// all the keys of a granularity are contiguous, and sort in the same order as the periods they represent.
+// Years are expected to fit in 16 bits.
+type Key uint64
 
-	dayKey, _ := strconv.Atoi(year + month + day)
-	return (dayKey * 1000000)
-}
+const (
+	secondShift      = 0
+	minuteShift      = 6
+	hourShift        = 12
+	dayShift         = 17
+	monthShift       = 22
+	yearShift        = 26
+	granularityShift = 42
+
+	sixBits     = 1<<6 - 1
+	fiveBits    = 1<<5 - 1
+	fourBits    = 1<<4 - 1
+	sixteenBits = 1<<16 - 1
+)
 
-// HourKey : makes a search key for a specific hour
-func HourKey(time time.Time) int {
-	year := year(time.Year())
-	month := month(time.Month())
-	day := day(time.Day())
-	hour := hour(time.Hour())
-
-	hourKey, _ := strconv.Atoi(year + month + day + hour)
-	return (hourKey * 10000)
-}
+// NewKey : makes a search key for the period of the given granularity the time falls in
+func NewKey(keyType KeyType, time time.Time) Key {
+	key := Key(keyType)<<granularityShift | Key(time.Year()&sixteenBits)<<yearShift
 
-// MinuteKey : makes a search key for a specific minute
-func MinuteKey(time time.Time) int {
-	year := year(time.Year())
-	month := month(time.Month())
-	day := day(time.Day())
-	hour := hour(time.Hour())
-	minute := minute(time.Minute())
-
-	minuteKey, _ := strconv.Atoi(year + month + day + hour + minute)
-	return (minuteKey * 100)
+	if keyType >= Month {
+		key |= Key(time.Month()) << monthShift
+	}
+
+	if keyType >= Day {
+		key |= Key(time.Day()) << dayShift
+	}
+
+	if keyType >= Hour {
+		key |= Key(time.Hour()) << hourShift
+	}
+
+	if keyType >= Minute {
+		key |= Key(time.Minute()) << minuteShift
+	}
+
+	if keyType >= Second {
+		key |= Key(time.Second()) << secondShift
+	}
+
+	return key
 }
 
-// SecondKey : makes a search key for a specific second
-func SecondKey(time time.Time) int {
-	year := year(time.Year())
-	month := month(time.Month())
-	day := day(time.Day())
-	hour := hour(time.Hour())
-	minute := minute(time.Minute())
-	second := second(time.Second())
-
-	secondKey, _ := strconv.Atoi(year + month + day + hour + minute + second)
-	return secondKey
+// YearKey : makes a search key for a whole year
+func YearKey(time time.Time) Key {
+	return NewKey(Year, time)
 }
 
-func year(year int) string {
-	return strconv.Itoa(year)
+// MonthKey : makes a search key for a month in a year
+func MonthKey(time time.Time) Key {
+	return NewKey(Month, time)
 }
 
-func month(month time.Month) string {
-	return pad(int(month))
+// DayKey : makes a search key for a specific day
+func DayKey(time time.Time) Key {
+	return NewKey(Day, time)
 }
 
-func day(day int) string {
-	return pad(day)
+// HourKey : makes a search key for a specific hour
+func HourKey(time time.Time) Key {
+	return NewKey(Hour, time)
 }
 
-func hour(hour int) string {
-	return padZeroableValue(hour)
+// MinuteKey : makes a search key for a specific minute
+func MinuteKey(time time.Time) Key {
+	return NewKey(Minute, time)
 }
 
-func minute(minute int) string {
-	return padZeroableValue(minute)
+// SecondKey : makes a search key for a specific second
+func SecondKey(time time.Time) Key {
+	return NewKey(Second, time)
 }
 
-func second(second int) string {
-	return padZeroableValue(second)
+// KeyType : the granularity of the key
+func (key Key) KeyType() KeyType {
+	return KeyType(key >> granularityShift)
 }
 
-func pad(n int) string {
-	if n < 10 {
-		return "0" + strconv.Itoa(n)
+// Time : the beginning of the period covered by the key, in UTC
+func (key Key) Time() time.Time {
+	month := time.Month((key >> monthShift) & fourBits)
+	if month == 0 {
+		month = time.January
 	}
 
-	return strconv.Itoa(n)
+	day := int((key >> dayShift) & fiveBits)
+	if day == 0 {
+		day = 1
+	}
+
+	return time.Date(
+		int((key>>yearShift)&sixteenBits),
+		month,
+		day,
+		int((key>>hourShift)&fiveBits),
+		int((key>>minuteShift)&sixBits),
+		int((key>>secondShift)&sixBits),
+		0,
+		time.UTC)
 }
 
-func padZeroableValue(n int) string {
-	return pad(n + 1)
+// Range : the period covered by the key, from start (inclusive) to end (exclusive)
+func (key Key) Range() (time.Time, time.Time) {
+	start := key.Time()
+
+	switch key.KeyType() {
+	case Year:
+		return start, start.AddDate(1, 0, 0)
+	case Month:
+		return start, start.AddDate(0, 1, 0)
+	case Day:
+		return start, start.AddDate(0, 0, 1)
+	case Hour:
+		return start, start.Add(time.Hour)
+	case Minute:
+		return start, start.Add(time.Minute)
+	}
+
+	return start, start.Add(time.Second)
 }
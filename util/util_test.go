@@ -31,6 +31,7 @@ func Test_IdentifyKey_ShouldIdentifyMinute(t *testing.T) {
 func Test_IdentifyKey_ShouldFail(t *testing.T) {
 	_, err := IdentifyKey("YYYY")
 	assert.Error(t, err, "YYYY is not a valid key")
+	assert.Equal(t, &KeyError{"YYYY"}, err, "The invalid key should be reported")
 
 	_, err = IdentifyKey("2021-MM")
 	assert.Error(t, err, "2021-MM is not a valid key")
@@ -45,35 +46,88 @@ func Test_IdentifyKey_ShouldFail(t *testing.T) {
 func Test_YearKey_ShouldSucceed(t *testing.T) {
 	time, _ := time.Parse(constant.DateFormat, constant.DateAsString)
 	key := YearKey(time)
-	assert.Equal(t, 20150000000000, key, "Key should be 20150000000000")
+	assert.Equal(t, Year, key.KeyType(), "Key should be a year key")
+	assert.Equal(t, "2015-01-01 00:00:00", key.Time().Format(constant.DateFormat), "Key should start on 2015-01-01 00:00:00")
 }
 
 func Test_MonthKey_ShouldSucceed(t *testing.T) {
 	time, _ := time.Parse(constant.DateFormat, constant.DateAsString)
 	key := MonthKey(time)
-	assert.Equal(t, 20150800000000, key, "Key should be 20150800000000")
+	assert.Equal(t, Month, key.KeyType(), "Key should be a month key")
+	assert.Equal(t, "2015-08-01 00:00:00", key.Time().Format(constant.DateFormat), "Key should start on 2015-08-01 00:00:00")
 }
 
 func Test_DayKey_ShouldSucceed(t *testing.T) {
 	time, _ := time.Parse(constant.DateFormat, constant.DateAsString)
 	key := DayKey(time)
-	assert.Equal(t, 20150801000000, key, "Key should be 20150801000000")
+	assert.Equal(t, Day, key.KeyType(), "Key should be a day key")
+	assert.Equal(t, "2015-08-01 00:00:00", key.Time().Format(constant.DateFormat), "Key should start on 2015-08-01 00:00:00")
 }
 
 func Test_HourKey_ShouldSucceed(t *testing.T) {
 	time, _ := time.Parse(constant.DateFormat, constant.DateAsString)
 	key := HourKey(time)
-	assert.Equal(t, 20150801010000, key, "Key should be 20150801010000")
+	assert.Equal(t, Hour, key.KeyType(), "Key should be an hour key")
+	assert.Equal(t, "2015-08-01 00:00:00", key.Time().Format(constant.DateFormat), "Key should start on 2015-08-01 00:00:00")
 }
 
 func Test_MinuteKey_ShouldSucceed(t *testing.T) {
 	time, _ := time.Parse(constant.DateFormat, constant.DateAsString)
 	key := MinuteKey(time)
-	assert.Equal(t, 20150801010400, key, "Key should be 20150801010100")
+	assert.Equal(t, Minute, key.KeyType(), "Key should be a minute key")
+	assert.Equal(t, "2015-08-01 00:03:00", key.Time().Format(constant.DateFormat), "Key should start on 2015-08-01 00:03:00")
 }
 
 func Test_SecondKey_ShouldSucceed(t *testing.T) {
 	time, _ := time.Parse(constant.DateFormat, constant.DateAsString)
 	key := SecondKey(time)
-	assert.Equal(t, 20150801010444, key, "Key should be 20150801010101")
+	assert.Equal(t, Second, key.KeyType(), "Key should be a second key")
+	assert.Equal(t, constant.DateAsString, key.Time().Format(constant.DateFormat), "Key should start on "+constant.DateAsString)
+}
+
+func Test_Key_Range(t *testing.T) {
+	time, _ := time.Parse(constant.DateFormat, "2016-02-29 23:59:59")
+	expected := map[KeyType][2]string{
+		Year:   {"2016-01-01 00:00:00", "2017-01-01 00:00:00"},
+		Month:  {"2016-02-01 00:00:00", "2016-03-01 00:00:00"},
+		Day:    {"2016-02-29 00:00:00", "2016-03-01 00:00:00"},
+		Hour:   {"2016-02-29 23:00:00", "2016-03-01 00:00:00"},
+		Minute: {"2016-02-29 23:59:00", "2016-03-01 00:00:00"},
+		Second: {"2016-02-29 23:59:59", "2016-03-01 00:00:00"},
+	}
+
+	for keyType, bounds := range expected {
+		start, end := NewKey(keyType, time).Range()
+		assert.Equal(t, bounds[0], start.Format(constant.DateFormat), "Range should start at "+bounds[0])
+		assert.Equal(t, bounds[1], end.Format(constant.DateFormat), "Range should end at "+bounds[1])
+	}
+}
+
+func Test_Key_ShouldBeOrderedByGranularityThenChronologically(t *testing.T) {
+	first, _ := time.Parse(constant.DateFormat, "2015-08-01 00:00:00")
+	second, _ := time.Parse(constant.DateFormat, "2015-08-01 00:01:00")
+	nextYear, _ := time.Parse(constant.DateFormat, "2016-01-01 00:00:00")
+
+	assert.True(t, MinuteKey(first) < MinuteKey(second), "Keys of a same granularity should be ordered chronologically")
+	assert.True(t, MinuteKey(second) < MinuteKey(nextYear), "Keys of a same granularity should be ordered chronologically")
+	assert.True(t, YearKey(nextYear) < MonthKey(first), "Coarser keys should be lower than finer keys")
+	assert.True(t, HourKey(first) != MinuteKey(first), "Keys of different granularities should never collide")
+	assert.True(t, MinuteKey(first) != SecondKey(first), "Keys of different granularities should never collide")
+}
+
+func Test_ParseKeyType_ShouldReadGranularityNames(t *testing.T) {
+	for keyType := Year; keyType <= Second; keyType++ {
+		parsed, err := ParseKeyType(keyType.String())
+		assert.NoError(t, err, "Granularity names should be parsed : "+keyType.String())
+		assert.Equal(t, keyType, parsed, "Granularity names should be parsed back to their key type")
+	}
+
+	_, err := ParseKeyType("week")
+	assert.Error(t, err, "week is not a granularity")
+}
+
+func Test_KeyType_String_ShouldNameGranularity(t *testing.T) {
+	assert.Equal(t, "year", Year.String(), "Year should be named year")
+	assert.Equal(t, "minute", Minute.String(), "Minute should be named minute")
+	assert.Equal(t, "unknown", KeyType(-1).String(), "An unsupported key type should be unknown")
 }